@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json" // For encoding the response
+	"net/http"      // For the breakdown handler
+	"sort"          // For ordering rows
+	"strings"       // For the search term
+)
+
+// =============================================================================
+// DIMENSION BREAKDOWNS
+// =============================================================================
+
+// breakdownSorts are the metrics a breakdown can be sorted by (descending)
+var breakdownSorts = map[string]bool{"views": true, "sessions": true, "visitors": true}
+
+// Breakdown is the response of the /stats/{trackingId}/breakdown endpoint
+type Breakdown struct {
+	Range     DateRange      `json:"range"`             // Reporting period
+	Compare   *DateRange     `json:"compare,omitempty"` // Comparison period (only with ?compare)
+	Dimension string         `json:"dimension"`         // Dimension the rows are grouped by
+	Sort      string         `json:"sort"`              // Metric the rows are sorted by: views, sessions or visitors
+	Search    string         `json:"search,omitempty"`  // Case-insensitive substring the row names were filtered by
+	Total     int            `json:"total"`             // Rows matching the search, before pagination
+	Offset    int            `json:"offset"`            // Index of the first returned row
+	Limit     int            `json:"limit"`             // Maximum number of rows returned
+	Rows      []DimensionRow `json:"rows"`              // One page of rows
+}
+
+// DimensionRow counts the page views (or events, for event dimensions) with one dimension value
+type DimensionRow struct {
+	Name     string  `json:"name"`             // Dimension value
+	Views    int     `json:"views"`            // Page views, or events for event and property dimensions
+	Sessions int     `json:"sessions"`         // Unique sessions
+	Visitors int     `json:"visitors"`         // Unique visitor IDs
+	Change   *Change `json:"change,omitempty"` // Change in views (only with ?compare)
+}
+
+// breakdownRecords selects the records a dimension is counted over
+// Event and property dimensions count custom events; every other dimension counts page views
+func breakdownRecords(records []PageView, dimension string) []PageView {
+	if dimension != "event" && !strings.HasPrefix(dimension, propertyPrefix) {
+		return pageViewsOnly(records)
+	}
+	var events []PageView
+	for _, pv := range records {
+		if !isPageView(pv) {
+			events = append(events, pv)
+		}
+	}
+	return events
+}
+
+// dimensionRows groups records by their value for a dimension, skipping empty values
+// Rows are returned in no particular order; see sortDimensionRows
+func dimensionRows(records []PageView, dimension string, website Website) []DimensionRow {
+	index := make(map[string]int)
+	sessionSets := make(map[string]map[string]bool)
+	visitorSets := make(map[string]map[string]bool)
+	rows := []DimensionRow{}
+
+	for _, pv := range records {
+		value := dimensionValue(pv, dimension, website)
+		if value == "" {
+			continue
+		}
+		i, ok := index[value]
+		if !ok {
+			i = len(rows)
+			index[value] = i
+			rows = append(rows, DimensionRow{Name: value})
+			sessionSets[value] = make(map[string]bool)
+			visitorSets[value] = make(map[string]bool)
+		}
+		rows[i].Views++
+		if pv.SessionID != "" {
+			sessionSets[value][pv.SessionID] = true
+		}
+		if pv.VisitorID != "" {
+			visitorSets[value][pv.VisitorID] = true
+		}
+	}
+
+	for i := range rows {
+		rows[i].Sessions = len(sessionSets[rows[i].Name])
+		rows[i].Visitors = len(visitorSets[rows[i].Name])
+	}
+	return rows
+}
+
+// sortDimensionRows orders rows by a metric, most first, breaking ties by name
+func sortDimensionRows(rows []DimensionRow, by string) {
+	metric := func(row DimensionRow) int {
+		switch by {
+		case "sessions":
+			return row.Sessions
+		case "visitors":
+			return row.Visitors
+		}
+		return row.Views
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if a, b := metric(rows[i]), metric(rows[j]); a != b {
+			return a > b
+		}
+		return rows[i].Name < rows[j].Name
+	})
+}
+
+// paginate returns up to limit rows starting at offset
+// Bounds are clamped before adding so large offsets cannot overflow
+func paginate(rows []DimensionRow, offset, limit int) []DimensionRow {
+	start := min(offset, len(rows))
+	end := start + min(limit, len(rows)-start)
+	return rows[start:end]
+}
+
+// breakdownHandler serves one page of a breakdown by any dimension
+// Parameters: dimension (required; any filter dimension except goal), sort=views|sessions|visitors (default views),
+// search=<substring>, limit (default 10), offset (default 0), plus the usual period, filter and compare parameters
+func breakdownHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	params := r.URL.Query()
+	dimension := params.Get("dimension")
+	if dimension == "" || !validDimension(dimension) {
+		writeQueryError(w, badQuery("unknown dimension %q: use a filter dimension such as page, browser or property:<name>", dimension))
+		return
+	}
+	if dimension == "goal" {
+		writeQueryError(w, badQuery("goals are reported with conversion rates in /stats/{id}; use another dimension"))
+		return
+	}
+	sortBy := params.Get("sort")
+	if sortBy == "" {
+		sortBy = "views"
+	}
+	if !breakdownSorts[sortBy] {
+		writeQueryError(w, badQuery("unknown sort %q: use views, sessions or visitors", sortBy))
+		return
+	}
+	limit, err := parseLimit(r, 10)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	search := params.Get("search")
+
+	records, err := loadReportViews(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	rows := dimensionRows(breakdownRecords(records, dimension), dimension, query.Website)
+	if search != "" {
+		matching := []DimensionRow{}
+		for _, row := range rows {
+			if strings.Contains(strings.ToLower(row.Name), strings.ToLower(search)) {
+				matching = append(matching, row)
+			}
+		}
+		rows = matching
+	}
+	sortDimensionRows(rows, sortBy)
+
+	response := Breakdown{
+		Range:     query.dateRange(),
+		Dimension: dimension,
+		Sort:      sortBy,
+		Search:    search,
+		Total:     len(rows),
+		Offset:    offset,
+		Limit:     limit,
+	}
+	rows = paginate(rows, offset, limit)
+
+	// Only the returned rows need previous values, so the comparison period is not paginated
+	if prev, ok := query.comparison(); ok {
+		previousRecords, err := loadReportViews(prev)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		previousViews := make(map[string]int)
+		for _, row := range dimensionRows(breakdownRecords(previousRecords, dimension), dimension, prev.Website) {
+			previousViews[row.Name] = row.Views
+		}
+		for i := range rows {
+			c := newChange(float64(rows[i].Views), float64(previousViews[rows[i].Name]))
+			rows[i].Change = &c
+		}
+		compareRange := prev.dateRange()
+		response.Compare = &compareRange
+	}
+	response.Rows = rows
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"            // For classifying query errors
+	"math"              // For the largest int
+	"net/http/httptest" // For building requests with query parameters
+	"net/url"           // For escaping query values
+	"strconv"           // For formatting offsets
+	"strings"           // For joining row names
+	"testing"           // For the test runner
+)
+
+// =============================================================================
+// BREAKDOWN TESTS
+// =============================================================================
+
+// rowNames lists the names of rows in order
+func rowNames(rows []DimensionRow) []string {
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = row.Name
+	}
+	return names
+}
+
+func TestPaginate(t *testing.T) {
+	rows := []DimensionRow{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		want   int // Number of rows returned
+		first  string
+	}{
+		{name: "first page", offset: 0, limit: 2, want: 2, first: "a"},
+		{name: "middle page", offset: 2, limit: 2, want: 2, first: "c"},
+		{name: "last partial page", offset: 4, limit: 2, want: 1, first: "e"},
+		{name: "limit larger than the rest", offset: 1, limit: maxLimit, want: 4, first: "b"},
+		{name: "offset at the end", offset: 5, limit: 2, want: 0},
+		{name: "offset past the end", offset: 50, limit: 2, want: 0},
+		{name: "largest offset", offset: maxOffset, limit: maxLimit, want: 0},
+		// Adding these naively would overflow and slice out of range
+		{name: "offset and limit near the int limit", offset: math.MaxInt, limit: math.MaxInt, want: 0},
+		{name: "limit near the int limit", offset: 3, limit: math.MaxInt, want: 2, first: "d"},
+	}
+	for _, tt := range tests {
+		got := paginate(rows, tt.offset, tt.limit)
+		if len(got) != tt.want || (tt.want > 0 && got[0].Name != tt.first) {
+			t.Errorf("%s: paginate(offset %d, limit %d) = %q, want %d rows from %q",
+				tt.name, tt.offset, tt.limit, rowNames(got), tt.want, tt.first)
+		}
+	}
+
+	if got := paginate(nil, 0, 10); len(got) != 0 {
+		t.Errorf("paginate of no rows = %q", rowNames(got))
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	valid := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 0},
+		{value: "0", want: 0},
+		{value: "20", want: 20},
+		{value: strconv.Itoa(maxOffset), want: maxOffset},
+	}
+	for _, tt := range valid {
+		r := httptest.NewRequest("GET", "/?offset="+url.QueryEscape(tt.value), nil)
+		if got, err := parseOffset(r); err != nil || got != tt.want {
+			t.Errorf("parseOffset(%q) = %d, %v; want %d", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"-1", strconv.Itoa(maxOffset + 1), "99999999999999999999", "1.5", "ten", " 5"} {
+		r := httptest.NewRequest("GET", "/?offset="+url.QueryEscape(value), nil)
+		_, err := parseOffset(r)
+		var qe *queryError
+		if !errors.As(err, &qe) {
+			t.Errorf("parseOffset(%q) = %v, want a queryError (400)", value, err)
+		}
+	}
+}
+
+func TestSortDimensionRows(t *testing.T) {
+	rows := []DimensionRow{
+		{Name: "Safari", Views: 5, Sessions: 5, Visitors: 1},
+		{Name: "Chrome", Views: 9, Sessions: 3, Visitors: 3},
+		{Name: "Firefox", Views: 9, Sessions: 4, Visitors: 3},
+		{Name: "Edge", Views: 1, Sessions: 1, Visitors: 1},
+	}
+	tests := []struct {
+		by   string
+		want string
+	}{
+		{by: "views", want: "Chrome,Firefox,Safari,Edge"}, // Ties are broken by name
+		{by: "sessions", want: "Safari,Firefox,Chrome,Edge"},
+		{by: "visitors", want: "Chrome,Firefox,Edge,Safari"},
+	}
+	for _, tt := range tests {
+		sorted := append([]DimensionRow(nil), rows...)
+		sortDimensionRows(sorted, tt.by)
+		if got := strings.Join(rowNames(sorted), ","); got != tt.want {
+			t.Errorf("sortDimensionRows by %s = %s, want %s", tt.by, got, tt.want)
+		}
+	}
+}
+
+func TestDimensionRows(t *testing.T) {
+	records := []PageView{
+		{SessionID: "s1", VisitorID: "v1", Browser: "Firefox"},
+		{SessionID: "s1", VisitorID: "v1", Browser: "Firefox"},
+		{SessionID: "s2", VisitorID: "v1", Browser: "Firefox"},
+		{SessionID: "s3", VisitorID: "v2", Browser: "Chrome"},
+		{Browser: "Chrome"}, // Anonymous: counts as a view only
+		{SessionID: "s4", VisitorID: "v3"},
+	}
+	rows := dimensionRows(records, "browser", Website{})
+	sortDimensionRows(rows, "views")
+	want := []DimensionRow{
+		{Name: "Firefox", Views: 3, Sessions: 2, Visitors: 1},
+		{Name: "Chrome", Views: 2, Sessions: 1, Visitors: 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("dimensionRows = %+v, want %+v (records without a value are skipped)", rows, want)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/url" // For parsing page URLs and query strings
+	"strings" // For string manipulation
+)
+
+// =============================================================================
+// CAMPAIGN TRACKING
+// =============================================================================
+
+// Campaign holds the marketing parameters extracted from a landing page URL
+type Campaign struct {
+	Source  string // utm_source, or a source inferred from ref/click ID parameters
+	Medium  string // utm_medium (e.g., "email", "cpc")
+	Name    string // utm_campaign
+	Term    string // utm_term (paid search keyword)
+	Content string // utm_content (ad or link variant)
+}
+
+// clickIDSources maps ad-platform click ID parameters to the source and medium they imply
+// These are only used when the URL carries no explicit utm_source/utm_medium
+var clickIDSources = []struct {
+	Param  string
+	Source string
+	Medium string
+}{
+	{Param: "gclid", Source: "google", Medium: "cpc"},
+	{Param: "dclid", Source: "google", Medium: "display"},
+	{Param: "msclkid", Source: "bing", Medium: "cpc"},
+	{Param: "fbclid", Source: "facebook", Medium: ""},
+	{Param: "ttclid", Source: "tiktok", Medium: "cpc"},
+	{Param: "twclid", Source: "twitter", Medium: "cpc"},
+	{Param: "li_fat_id", Source: "linkedin", Medium: "cpc"},
+}
+
+// parseCampaign extracts UTM parameters from a page URL
+// It falls back to ref/source parameters and ad click IDs when utm_source is missing
+func parseCampaign(pageURL string) Campaign {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return Campaign{}
+	}
+	query := u.Query()
+
+	// Values are normalized so "Newsletter" and "newsletter " are reported together
+	get := func(key string) string {
+		return strings.ToLower(strings.TrimSpace(query.Get(key)))
+	}
+
+	campaign := Campaign{
+		Source:  get("utm_source"),
+		Medium:  get("utm_medium"),
+		Name:    get("utm_campaign"),
+		Term:    get("utm_term"),
+		Content: get("utm_content"),
+	}
+
+	// Many sites link with ?ref=producthunt or ?source=newsletter instead of UTM tags
+	if campaign.Source == "" {
+		campaign.Source = get("ref")
+	}
+	if campaign.Source == "" {
+		campaign.Source = get("source")
+	}
+
+	// Auto-tagged ad clicks carry a click ID but no UTM parameters
+	for _, click := range clickIDSources {
+		if query.Get(click.Param) == "" {
+			continue
+		}
+		if campaign.Source == "" {
+			campaign.Source = click.Source
+		}
+		if campaign.Medium == "" {
+			campaign.Medium = click.Medium
+		}
+		break
+	}
+
+	return campaign
+}
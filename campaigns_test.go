@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing" // For the test runner
+)
+
+// =============================================================================
+// CAMPAIGN PARSING TESTS
+// =============================================================================
+
+func TestParseCampaign(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want Campaign
+	}{
+		{name: "no parameters", url: "https://example.com/pricing", want: Campaign{}},
+		{
+			name: "all UTM parameters",
+			url:  "https://example.com/?utm_source=newsletter&utm_medium=email&utm_campaign=spring&utm_term=analytics&utm_content=header",
+			want: Campaign{Source: "newsletter", Medium: "email", Name: "spring", Term: "analytics", Content: "header"},
+		},
+		// Values are lowercased and trimmed so variants are reported together; parameter names are exact
+		{name: "values are normalized", url: "https://example.com/?utm_source=%20Newsletter%20&utm_campaign=Spring+Sale", want: Campaign{Source: "newsletter", Name: "spring sale"}},
+		{name: "parameter names are case-sensitive", url: "https://example.com/?UTM_SOURCE=newsletter", want: Campaign{}},
+		{name: "blank utm_source", url: "https://example.com/?utm_source=%20&ref=producthunt", want: Campaign{Source: "producthunt"}},
+		// utm_source wins over ref, and ref over source
+		{name: "utm_source before ref", url: "https://example.com/?ref=producthunt&utm_source=newsletter", want: Campaign{Source: "newsletter"}},
+		{name: "ref before source", url: "https://example.com/?source=blog&ref=ProductHunt", want: Campaign{Source: "producthunt"}},
+		{name: "source", url: "https://example.com/?source=blog&utm_medium=social", want: Campaign{Source: "blog", Medium: "social"}},
+		// Click IDs only fill in what the URL does not say
+		{name: "gclid", url: "https://example.com/?gclid=abc", want: Campaign{Source: "google", Medium: "cpc"}},
+		{name: "dclid", url: "https://example.com/?dclid=abc", want: Campaign{Source: "google", Medium: "display"}},
+		{name: "msclkid", url: "https://example.com/?msclkid=abc", want: Campaign{Source: "bing", Medium: "cpc"}},
+		{name: "fbclid has no medium", url: "https://example.com/?fbclid=abc", want: Campaign{Source: "facebook"}},
+		{name: "li_fat_id", url: "https://example.com/?li_fat_id=abc", want: Campaign{Source: "linkedin", Medium: "cpc"}},
+		{name: "UTM tags win over a click ID", url: "https://example.com/?gclid=abc&utm_source=newsletter&utm_medium=email", want: Campaign{Source: "newsletter", Medium: "email"}},
+		{name: "click ID fills in the medium", url: "https://example.com/?gclid=abc&utm_source=brand", want: Campaign{Source: "brand", Medium: "cpc"}},
+		{name: "ref wins over a click ID", url: "https://example.com/?ref=partner&ttclid=abc", want: Campaign{Source: "partner", Medium: "cpc"}},
+		{name: "click IDs are checked in table order", url: "https://example.com/?fbclid=abc&msclkid=def", want: Campaign{Source: "bing", Medium: "cpc"}},
+		{name: "empty click ID", url: "https://example.com/?gclid=", want: Campaign{}},
+		{name: "click ID names are case-sensitive", url: "https://example.com/?GCLID=abc", want: Campaign{}},
+		{name: "unparsable URL", url: "https://example.com/%zz?utm_source=newsletter", want: Campaign{}},
+	}
+	for _, tt := range tests {
+		if got := parseCampaign(tt.url); got != tt.want {
+			t.Errorf("%s: parseCampaign(%q) = %+v, want %+v", tt.name, tt.url, got, tt.want)
+		}
+	}
+}
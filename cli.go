@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag" // For parsing command flags
+	"fmt"  // For printing command output
+	"net"  // For recognizing stored IP addresses
+	"os"   // For writing usage to stderr
+	"sort" // For listing commands in order
+)
+
+// =============================================================================
+// COMMAND LINE
+// =============================================================================
+
+// command is a one-off maintenance task run as "./analytics <name> [flags]" instead of starting the server
+// Commands edit the data files directly, so stop the server before running one
+type command struct {
+	Description string
+	Run         func(args []string) error
+}
+
+// commands lists every available maintenance command by name
+var commands = map[string]command{
+	"anonymize-ips": {
+		Description: "Apply each website's ip_mode to page views that are already stored",
+		Run:         runAnonymizeIPs,
+	},
+	"backup": {
+		Description: "Copy page view data to a file, optionally decrypted or re-encrypted",
+		Run:         runBackup,
+	},
+	"generate-key": {
+		Description: "Print a new random encryption key for DATA_KEY or DATA_KEY_FILE",
+		Run:         runGenerateKey,
+	},
+	"rebuild-sketches": {
+		Description: "Recompute unique count sketches from stored page views",
+		Run:         runRebuildSketches,
+	},
+	"rotate-key": {
+		Description: "Re-encrypt page view data with the primary (first) key",
+		Run:         runRotateKey,
+	},
+	"scrub": {
+		Description: "Re-apply each website's URL scrubbing rules to stored page views",
+		Run:         runScrub,
+	},
+	"subject-export": {
+		Description: "Export all page views for a session ID, visitor ID or IP as JSON",
+		Run:         runSubjectExport,
+	},
+	"subject-delete": {
+		Description: "Delete all page views for a session ID, visitor ID, user ID or IP",
+		Run:         runSubjectDelete,
+	},
+}
+
+// runCommand dispatches a command line to the matching maintenance command
+func runCommand(args []string) error {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return nil
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.Run(args[1:])
+}
+
+// printUsage lists the available commands on stderr
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: analytics [command] [flags]")
+	fmt.Fprintln(os.Stderr, "Run without a command to start the server.")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].Description)
+	}
+}
+
+// loadWebsiteMap reads all websites keyed by tracking ID
+func loadWebsiteMap() (map[string]Website, error) {
+	var websites []Website
+	if err := readJSONFile(websitesFile, &websites); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Website, len(websites))
+	for _, website := range websites {
+		byID[website.ID] = website
+	}
+	return byID, nil
+}
+
+// runAnonymizeIPs rewrites stored IP addresses according to each website's current ip_mode
+func runAnonymizeIPs(args []string) error {
+	flags := flag.NewFlagSet("anonymize-ips", flag.ContinueOnError)
+	websiteID := flags.String("website", "", "only process page views for this website ID")
+	dryRun := flags.Bool("dry-run", false, "report how many records would change without saving")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	websites, err := loadWebsiteMap()
+	if err != nil {
+		return fmt.Errorf("could not read websites: %w", err)
+	}
+	for _, website := range websites {
+		if !validIPModes[ipMode(website)] {
+			return fmt.Errorf("website %s has unknown ip_mode %q", website.ID, website.IPMode)
+		}
+		if ipMode(website) == ipModeHash && os.Getenv("IP_HASH_SECRET") == "" {
+			return fmt.Errorf("website %s uses ip_mode \"hash\" but IP_HASH_SECRET is not set", website.ID)
+		}
+	}
+
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return fmt.Errorf("could not read page views: %w", err)
+	}
+
+	changed := 0
+	for i, pv := range pageViews {
+		if pv.IPAddress == "" || (*websiteID != "" && pv.WebsiteID != *websiteID) {
+			continue
+		}
+		mode := ipMode(websites[pv.WebsiteID])
+		// Hashed values are no longer IP addresses; hashing them again would change them for nothing
+		if mode == ipModeHash && net.ParseIP(pv.IPAddress) == nil {
+			continue
+		}
+		if anonymized := anonymizeIP(pv.IPAddress, mode); anonymized != pv.IPAddress {
+			pageViews[i].IPAddress = anonymized
+			changed++
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("%d of %d page views would be updated\n", changed, len(pageViews))
+		return nil
+	}
+	if changed > 0 {
+		if err := writeJSONFile(pageViewsFile, pageViews); err != nil {
+			return fmt.Errorf("could not save page views: %w", err)
+		}
+	}
+	fmt.Printf("Updated %d of %d page views\n", changed, len(pageViews))
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"math" // For rounding day counts across DST changes
+	"time" // For matching elapsed time in partial periods
+)
+
+// =============================================================================
+// PERIOD COMPARISON
+// =============================================================================
+
+// Values of the compare query parameter
+const (
+	comparePrevious = "previous" // The equivalent period immediately before the current one
+	compareYear     = "year"     // The same dates one year earlier
+)
+
+// Change compares a metric with its value in the comparison period
+type Change struct {
+	Previous float64  `json:"previous"` // Value in the comparison period
+	Change   float64  `json:"change"`   // Absolute difference (current - previous)
+	Percent  *float64 `json:"percent"`  // Difference as a percentage of the previous value; null when the previous value is 0
+}
+
+// SummaryChanges holds the comparison for each summary metric
+type SummaryChanges struct {
+	TotalViews      Change `json:"total_views"`
+	UniqueSessions  Change `json:"unique_sessions"`
+	UniqueVisitors  Change `json:"unique_visitors"`
+	DaysWithTraffic Change `json:"days_with_traffic"`
+	OptOuts         Change `json:"opt_outs"`
+	OptOutRate      Change `json:"opt_out_rate"` // Change in percentage points
+
+	BounceRate            Change `json:"bounce_rate"` // Change in percentage points
+	ViewsPerSession       Change `json:"views_per_session"`
+	AvgSessionDuration    Change `json:"avg_session_duration"`
+	MedianSessionDuration Change `json:"median_session_duration"`
+}
+
+// newChange computes the absolute and relative change between two values
+func newChange(current, previous float64) Change {
+	c := Change{Previous: previous, Change: current - previous}
+	if previous != 0 {
+		percent := (current - previous) * 100 / previous
+		c.Percent = &percent
+	}
+	return c
+}
+
+// comparison returns the query for the period the current one is compared against
+// It reports false when the request did not ask for a comparison.
+// "previous" steps back by the period's length: one calendar month for period=month,
+// one year for period=year and the same number of days otherwise.
+func (q reportQuery) comparison() (reportQuery, bool) {
+	return q.comparisonAt(time.Now())
+}
+
+// comparisonAt is comparison with the current time given explicitly
+// A period still in progress (today, this month, this year) is compared over the same elapsed span:
+// the previous range ends at the moment that corresponds to now, so a partial month is never
+// measured against a whole one.
+func (q reportQuery) comparisonAt(now time.Time) (reportQuery, bool) {
+	previous := q
+	previous.Compare = ""
+	// The comparison range is an explicit pair of dates, whatever period produced it
+	previous.Period = "custom"
+
+	// shift maps a time in the current range to the matching time in the comparison range
+	var shift func(t time.Time) time.Time
+	switch q.Compare {
+	case compareYear:
+		shift = func(t time.Time) time.Time { return t.AddDate(-1, 0, 0) }
+	case comparePrevious:
+		switch q.Period {
+		case "month":
+			shift = func(t time.Time) time.Time { return t.AddDate(0, -1, 0) }
+		case "year":
+			shift = func(t time.Time) time.Time { return t.AddDate(-1, 0, 0) }
+		default:
+			// Ranges are whole days; rounding absorbs the hour gained or lost at a DST change
+			days := int(math.Round(q.End.Sub(q.Start).Hours() / 24))
+			shift = func(t time.Time) time.Time { return t.AddDate(0, 0, -days) }
+		}
+	default:
+		return q, false
+	}
+	previous.Start, previous.End = shift(q.Start), shift(q.End)
+	if q.Compare == comparePrevious {
+		previous.End = q.Start
+	}
+
+	// Cut the comparison range at the time matching now; a month-end overflow
+	// (e.g. 31 March -> "31 February" = 3 March) is clamped to the range's end
+	if now = now.In(q.Location); now.After(q.Start) && now.Before(q.End) {
+		if end := shift(now); end.Before(previous.End) {
+			previous.End = end
+		}
+	}
+	return previous, true
+}
+
+// parseCompare validates the compare query parameter
+func parseCompare(value string) (string, error) {
+	switch value {
+	case "", comparePrevious, compareYear:
+		return value, nil
+	default:
+		return "", badQuery("unknown compare %q: use previous or year", value)
+	}
+}
+
+// compareWith attaches the change since the previous stats to the summary and every breakdown row
+// previous should be built without a row limit so rows outside its top 10 still have a value
+func (s *Stats) compareWith(previous Stats) {
+	compareRange := previous.Range
+	s.Compare = &compareRange
+
+	s.Summary.Changes = &SummaryChanges{
+		TotalViews:      newChange(float64(s.Summary.TotalViews), float64(previous.Summary.TotalViews)),
+		UniqueSessions:  newChange(float64(s.Summary.UniqueSessions), float64(previous.Summary.UniqueSessions)),
+		UniqueVisitors:  newChange(float64(s.Summary.UniqueVisitors), float64(previous.Summary.UniqueVisitors)),
+		DaysWithTraffic: newChange(float64(s.Summary.DaysWithTraffic), float64(previous.Summary.DaysWithTraffic)),
+		OptOuts:         newChange(float64(s.Summary.OptOuts), float64(previous.Summary.OptOuts)),
+		OptOutRate:      newChange(s.Summary.OptOutRate, previous.Summary.OptOutRate),
+
+		BounceRate:            newChange(s.Summary.BounceRate, previous.Summary.BounceRate),
+		ViewsPerSession:       newChange(s.Summary.ViewsPerSession, previous.Summary.ViewsPerSession),
+		AvgSessionDuration:    newChange(s.Summary.AvgSessionDuration, previous.Summary.AvgSessionDuration),
+		MedianSessionDuration: newChange(s.Summary.MedianSessionDuration, previous.Summary.MedianSessionDuration),
+	}
+
+	pageViews := make(map[string]int)
+	for _, page := range previous.TopPages {
+		pageViews[page.PageURL] = page.Views
+	}
+	for i, page := range s.TopPages {
+		c := newChange(float64(page.Views), float64(pageViews[page.PageURL]))
+		s.TopPages[i].Change = &c
+	}
+
+	browserCounts := make(map[string]int)
+	for _, browser := range previous.Browsers {
+		browserCounts[browser.Browser] = browser.Count
+	}
+	for i, browser := range s.Browsers {
+		c := newChange(float64(browser.Count), float64(browserCounts[browser.Browser]))
+		s.Browsers[i].Change = &c
+	}
+
+	landingSessions := make(map[string]int)
+	for _, page := range previous.LandingPages {
+		landingSessions[page.PageURL] = page.Sessions
+	}
+	for i, page := range s.LandingPages {
+		c := newChange(float64(page.Sessions), float64(landingSessions[page.PageURL]))
+		s.LandingPages[i].Change = &c
+	}
+
+	goalCompletions := make(map[string]int)
+	for _, goal := range previous.Goals {
+		goalCompletions[goal.Name] = goal.Completions
+	}
+	for i, goal := range s.Goals {
+		c := newChange(float64(goal.Completions), float64(goalCompletions[goal.Name]))
+		s.Goals[i].Change = &c
+	}
+
+	brokenViews := make(map[string]int)
+	for _, page := range previous.BrokenPages {
+		brokenViews[page.PageURL] = page.Views
+	}
+	for i, page := range s.BrokenPages {
+		c := newChange(float64(page.Views), float64(brokenViews[page.PageURL]))
+		s.BrokenPages[i].Change = &c
+	}
+
+	var previousReferrers []BreakdownRow
+	for _, row := range previous.Referrers {
+		previousReferrers = append(previousReferrers, row.BreakdownRow)
+	}
+	for i := range s.Referrers {
+		compareRow(&s.Referrers[i].BreakdownRow, previousReferrers)
+	}
+
+	compareRows(s.Events, previous.Events)
+	compareRows(s.Campaigns, previous.Campaigns)
+	compareRows(s.Sources, previous.Sources)
+	compareRows(s.Mediums, previous.Mediums)
+	compareRows(s.Channels, previous.Channels)
+	compareRows(s.OperatingSystems, previous.OperatingSystems)
+	compareRows(s.Devices, previous.Devices)
+	compareRows(s.Countries, previous.Countries)
+	compareRows(s.Regions, previous.Regions)
+}
+
+// compareRows sets the change in views on each row, matching rows by name
+// Rows missing from the previous breakdown had no views then
+func compareRows(rows, previous []BreakdownRow) {
+	for i := range rows {
+		compareRow(&rows[i], previous)
+	}
+}
+
+// compareRow sets the change in views on a single row
+func compareRow(row *BreakdownRow, previous []BreakdownRow) {
+	views := 0
+	for _, p := range previous {
+		if p.Name == row.Name {
+			views = p.Views
+			break
+		}
+	}
+	c := newChange(float64(row.Views), float64(views))
+	row.Change = &c
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"  // For classifying query errors
+	"math"    // For comparing floating-point percentages
+	"testing" // For the test runner
+	"time"    // For building report ranges
+)
+
+// =============================================================================
+// PERIOD COMPARISON TESTS
+// =============================================================================
+
+func TestComparisonAt(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+
+	tests := []struct {
+		name      string
+		period    string
+		from, to  string
+		compare   string
+		now       string
+		loc       *time.Location
+		wantStart string
+		wantEnd   string
+	}{
+		{name: "previous month, part way through", period: "month", compare: comparePrevious,
+			now: "2026-09-18 10:00", loc: time.UTC, wantStart: "2026-08-01 00:00", wantEnd: "2026-08-18 10:00"},
+		// "31 February" overflows into March, so the comparison is clamped to the whole of February
+		{name: "previous month on the 31st", period: "month", compare: comparePrevious,
+			now: "2026-03-31 12:00", loc: time.UTC, wantStart: "2026-02-01 00:00", wantEnd: "2026-03-01 00:00"},
+		{name: "previous month into a leap year February", period: "month", compare: comparePrevious,
+			now: "2028-03-30 08:00", loc: time.UTC, wantStart: "2028-02-01 00:00", wantEnd: "2028-03-01 00:00"},
+		{name: "previous year, part way through", period: "year", compare: comparePrevious,
+			now: "2026-09-18 10:00", loc: time.UTC, wantStart: "2025-01-01 00:00", wantEnd: "2025-09-18 10:00"},
+		{name: "today against yesterday", period: "today", compare: comparePrevious,
+			now: "2026-09-18 10:00", loc: newYork, wantStart: "2026-09-17 00:00", wantEnd: "2026-09-17 10:00"},
+		// The current week contains the 23-hour day of 8 March; it still counts as 7 days
+		{name: "previous 7 days across a DST change", period: "7d", compare: comparePrevious,
+			now: "2026-03-10 12:00", loc: newYork, wantStart: "2026-02-25 00:00", wantEnd: "2026-03-03 12:00"},
+		{name: "same month last year", period: "month", compare: compareYear,
+			now: "2026-09-18 10:00", loc: time.UTC, wantStart: "2025-09-01 00:00", wantEnd: "2025-09-18 10:00"},
+		// The range ends at midnight after 29 February, so a year earlier it still covers all of February
+		{name: "leap year February last year", period: "custom", from: "2028-02-01", to: "2028-02-29", compare: compareYear,
+			now: "2028-06-01 12:00", loc: time.UTC, wantStart: "2027-02-01 00:00", wantEnd: "2027-03-01 00:00"},
+		// A range that has already finished is compared in full
+		{name: "past custom range", period: "custom", from: "2026-01-01", to: "2026-01-31", compare: comparePrevious,
+			now: "2026-09-18 10:00", loc: time.UTC, wantStart: "2025-12-01 00:00", wantEnd: "2026-01-01 00:00"},
+		{name: "past month across a DST change", period: "custom", from: "2026-03-01", to: "2026-03-31", compare: comparePrevious,
+			now: "2026-09-18 10:00", loc: newYork, wantStart: "2026-01-29 00:00", wantEnd: "2026-03-01 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := at(t, tt.now, tt.loc)
+			start, end, err := periodRange(tt.period, tt.from, tt.to, now, tt.loc)
+			if err != nil {
+				t.Fatalf("periodRange: %v", err)
+			}
+			q := reportQuery{Location: tt.loc, Period: tt.period, Compare: tt.compare, Start: start, End: end}
+
+			previous, ok := q.comparisonAt(now)
+			if !ok {
+				t.Fatal("comparisonAt reported no comparison")
+			}
+			wantStart, wantEnd := at(t, tt.wantStart, tt.loc), at(t, tt.wantEnd, tt.loc)
+			if !previous.Start.Equal(wantStart) || !previous.End.Equal(wantEnd) {
+				t.Errorf("comparison = [%s, %s), want [%s, %s)", previous.Start, previous.End, wantStart, wantEnd)
+			}
+			if previous.Period != "custom" || previous.Compare != "" {
+				t.Errorf("comparison has period %q and compare %q, want custom and none", previous.Period, previous.Compare)
+			}
+		})
+	}
+
+	// Without ?compare there is nothing to compare against
+	q := reportQuery{Location: time.UTC, Period: "month"}
+	if _, ok := q.comparisonAt(time.Now()); ok {
+		t.Error("comparisonAt without compare reported a comparison")
+	}
+}
+
+func TestParseCompare(t *testing.T) {
+	for _, value := range []string{"", comparePrevious, compareYear} {
+		if got, err := parseCompare(value); err != nil || got != value {
+			t.Errorf("parseCompare(%q) = %q, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"week", "Previous", "1"} {
+		_, err := parseCompare(value)
+		var qe *queryError
+		if !errors.As(err, &qe) {
+			t.Errorf("parseCompare(%q) = %v, want a queryError (400)", value, err)
+		}
+	}
+}
+
+func TestNewChange(t *testing.T) {
+	c := newChange(150, 100)
+	if c.Previous != 100 || c.Change != 50 || c.Percent == nil || math.Abs(*c.Percent-50) > 1e-9 {
+		t.Errorf("newChange(150, 100) = %+v, want +50 (50%%)", c)
+	}
+	c = newChange(25, 100)
+	if c.Change != -75 || c.Percent == nil || math.Abs(*c.Percent+75) > 1e-9 {
+		t.Errorf("newChange(25, 100) = %+v, want -75 (-75%%)", c)
+	}
+	// Growth from nothing has no meaningful percentage
+	if c = newChange(10, 0); c.Change != 10 || c.Percent != nil {
+		t.Errorf("newChange(10, 0) = %+v, want +10 with no percentage", c)
+	}
+}
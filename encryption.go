@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"           // For detecting encrypted files
+	"crypto/aes"      // For the AES block cipher
+	"crypto/cipher"   // For AES-GCM authenticated encryption
+	"crypto/rand"     // For generating keys and nonces
+	"crypto/sha256"   // For deriving key IDs
+	"encoding/base64" // For encoding keys
+	"encoding/hex"    // For printing key IDs
+	"encoding/json"   // For writing backups
+	"errors"          // For sentinel errors
+	"flag"            // For parsing command flags
+	"fmt"             // For error formatting
+	"io"              // For reading file headers
+	"os"              // For reading key files and writing backups
+	"strings"         // For parsing key lists
+)
+
+// =============================================================================
+// ENCRYPTION AT REST
+// =============================================================================
+
+// encryptedMagic prefixes every encrypted data file
+// Layout: magic (6 bytes) | key ID (8 bytes) | nonce (12 bytes) | AES-256-GCM ciphertext
+var encryptedMagic = []byte("IAENC1")
+
+const (
+	keyIDSize = 8
+	keySize   = 32 // AES-256
+)
+
+var (
+	// dataKeys holds the encryption keys loaded from DATA_KEY or DATA_KEY_FILE; nil when encryption is off
+	dataKeys *keyring
+
+	// errNoDataKey is returned when an encrypted file is read without a matching key
+	errNoDataKey = errors.New("file is encrypted but no matching key is configured (DATA_KEY or DATA_KEY_FILE)")
+
+	// errPlaintextOverEncrypted is returned instead of replacing an encrypted file with plaintext
+	errPlaintextOverEncrypted = errors.New("refusing to overwrite an encrypted file with plaintext: configure its key (DATA_KEY or DATA_KEY_FILE)")
+)
+
+// encryptedFiles lists the data files written encrypted when a key is configured
+// Only files holding personal data or the secrets used to derive it are encrypted; website configuration stays readable
+var encryptedFiles = []string{pageViewsFile, saltFile}
+
+// keyring holds the primary key used for writing and any older keys still accepted for reading
+type keyring struct {
+	primary []byte
+	keys    map[string][]byte // key ID -> key
+}
+
+// loadKeyring reads encryption keys from DATA_KEY_FILE or DATA_KEY
+// Both hold base64-encoded 32-byte keys: the file one per line, the variable comma-separated.
+// The first key is the primary; the others are only used to decrypt data written before a rotation.
+func loadKeyring() error {
+	var encoded []string
+	if path := os.Getenv("DATA_KEY_FILE"); path != "" {
+		lines, err := readKeyFile(path)
+		if err != nil {
+			return err
+		}
+		encoded = lines
+	} else if env := os.Getenv("DATA_KEY"); env != "" {
+		for _, key := range strings.Split(env, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				encoded = append(encoded, key)
+			}
+		}
+	}
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	keys, err := decodeKeys(encoded)
+	if err != nil {
+		return err
+	}
+	ring := &keyring{primary: keys[0], keys: make(map[string][]byte)}
+	for _, key := range keys {
+		ring.keys[string(keyID(key))] = key
+	}
+	dataKeys = ring
+	return nil
+}
+
+// readKeyFile returns the non-empty, non-comment lines of a key file
+func readKeyFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// decodeKeys parses base64-encoded keys, checking each is 32 bytes
+func decodeKeys(encoded []string) ([][]byte, error) {
+	keys := make([][]byte, 0, len(encoded))
+	for i, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("key %d is not a base64-encoded %d-byte key", i+1, keySize)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// keyID derives a short, non-secret identifier for a key so files record which key encrypted them
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("initium-key-id:"), key...))
+	return sum[:keyIDSize]
+}
+
+// isEncrypted reports whether file contents were written by encryptData
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// encryptData seals plaintext with the given key using AES-256-GCM
+// The header (magic and key ID) is authenticated as additional data
+func encryptData(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte{}, encryptedMagic...), keyID(key)...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// decryptData opens data written by encryptData, picking the key by the ID in its header
+func decryptData(data []byte, ring *keyring) ([]byte, error) {
+	headerSize := len(encryptedMagic) + keyIDSize
+	if len(data) < headerSize+12 {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	if ring == nil {
+		return nil, errNoDataKey
+	}
+	header := data[:headerSize]
+	key, ok := ring.keys[string(header[len(encryptedMagic):])]
+	if !ok {
+		return nil, errNoDataKey
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := data[headerSize : headerSize+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, data[headerSize+gcm.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("failed to decrypt file: data was tampered with or the key is wrong")
+	}
+	return plaintext, nil
+}
+
+// newGCM creates an AES-GCM cipher for a 32-byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// shouldEncrypt reports whether a data file is written encrypted
+func shouldEncrypt(filename string) bool {
+	if dataKeys == nil {
+		return false
+	}
+	for _, name := range encryptedFiles {
+		if name == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// fileIsEncrypted reports whether an existing file starts with the encryption header
+func fileIsEncrypted(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return isEncrypted(header)
+}
+
+// checkEncryptedFiles makes sure every encrypted data file can be decrypted with the configured keys
+// The server refuses to start otherwise, rather than failing every hit (or, worse, starting over with an empty file)
+func checkEncryptedFiles() error {
+	for _, filename := range encryptedFiles {
+		data, err := os.ReadFile(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !isEncrypted(data) {
+			continue
+		}
+		if _, err := decryptData(data, dataKeys); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// runGenerateKey prints a new random key suitable for DATA_KEY or a line of DATA_KEY_FILE
+func runGenerateKey(args []string) error {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
+
+// runRotateKey re-encrypts the page view data and the daily salt with the primary key
+// Put the new key first in DATA_KEY/DATA_KEY_FILE, keep the old one after it, run this, then remove the old key
+func runRotateKey(args []string) error {
+	if dataKeys == nil {
+		return errors.New("no encryption key configured (DATA_KEY or DATA_KEY_FILE)")
+	}
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return fmt.Errorf("could not read page views: %w", err)
+	}
+	if err := writeJSONFile(pageViewsFile, pageViews); err != nil {
+		return fmt.Errorf("could not save page views: %w", err)
+	}
+	var salt dailySalt
+	if err := readJSONFile(saltFile, &salt); err == nil {
+		if err := writeJSONFile(saltFile, salt); err != nil {
+			return fmt.Errorf("could not save salt: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not read salt: %w", err)
+	}
+	fmt.Printf("Re-encrypted %d page views with key %s\n", len(pageViews), hex.EncodeToString(keyID(dataKeys.primary)))
+	return nil
+}
+
+// runBackup copies the page view data to a file, optionally changing its encryption
+// By default the backup is encrypted if a key is configured. --decrypt writes plaintext JSON;
+// --key-file re-encrypts with the first key in a different file (e.g., an offline backup key).
+// Backups are snapshots: later data subject deletions do not reach them.
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("out", "", "file to write the backup to (required)")
+	decrypt := flags.Bool("decrypt", false, "write the backup as plaintext JSON")
+	keyFile := flags.String("key-file", "", "re-encrypt the backup with the first key in this file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("--out is required")
+	}
+	if *decrypt && *keyFile != "" {
+		return errors.New("--decrypt and --key-file cannot be used together")
+	}
+
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return fmt.Errorf("could not read page views: %w", err)
+	}
+	data, err := json.MarshalIndent(pageViews, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	var key []byte
+	switch {
+	case *keyFile != "":
+		lines, err := readKeyFile(*keyFile)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return errors.New("key file contains no keys")
+		}
+		keys, err := decodeKeys(lines[:1])
+		if err != nil {
+			return err
+		}
+		key = keys[0]
+	case !*decrypt && dataKeys != nil:
+		key = dataKeys.primary
+	}
+	if key != nil {
+		if data, err = encryptData(data, key); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(*out, data, 0600); err != nil {
+		return fmt.Errorf("could not write backup: %w", err)
+	}
+	state := "plaintext"
+	if key != nil {
+		state = "encrypted with key " + hex.EncodeToString(keyID(key))
+	}
+	fmt.Printf("Backed up %d page views to %s (%s)\n", len(pageViews), *out, state)
+	return nil
+}
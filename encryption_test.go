@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"           // For comparing plaintext
+	"encoding/base64" // For writing key files
+	"errors"          // For matching sentinel errors
+	"os"              // For reading and writing test files
+	"path/filepath"   // For temporary file paths
+	"testing"         // For the test runner
+)
+
+// useTempDataFiles points the page view and salt files at a temporary directory for one test
+func useTempDataFiles(t *testing.T) {
+	t.Helper()
+	useTempSalt(t)
+	previous := pageViewsFile
+	t.Cleanup(func() { pageViewsFile = previous })
+
+	pageViewsFile = filepath.Join(t.TempDir(), "pageviews.json")
+	encryptedFiles = []string{pageViewsFile, saltFile}
+}
+
+// =============================================================================
+// ENCRYPTION TESTS
+// =============================================================================
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, otherKey := newTestKey(t), newTestKey(t)
+	ring := &keyring{primary: key, keys: map[string][]byte{string(keyID(key)): key}}
+	plaintext := []byte(`[{"id":"1","page_url":"https://example.com/"}]`)
+
+	sealed, err := encryptData(plaintext, key)
+	if err != nil {
+		t.Fatalf("encryptData: %v", err)
+	}
+	if !isEncrypted(sealed) || !bytes.Equal(sealed[len(encryptedMagic):len(encryptedMagic)+keyIDSize], keyID(key)) {
+		t.Fatal("encrypted data does not start with the magic and key ID")
+	}
+	if bytes.Contains(sealed, []byte("example.com")) {
+		t.Fatal("encrypted data contains plaintext")
+	}
+	again, _ := encryptData(plaintext, key)
+	if bytes.Equal(sealed, again) {
+		t.Error("encrypting twice gave identical output; nonces must be random")
+	}
+
+	opened, err := decryptData(sealed, ring)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("decryptData = %q, %v; want the plaintext", opened, err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		ring    *keyring
+		wantErr error // nil means any error
+	}{
+		{name: "no keys configured", data: sealed, ring: nil, wantErr: errNoDataKey},
+		{name: "wrong key", data: sealed,
+			ring: &keyring{primary: otherKey, keys: map[string][]byte{string(keyID(otherKey)): otherKey}}, wantErr: errNoDataKey},
+		// A key filed under the right ID but with the wrong bytes must fail authentication
+		{name: "wrong key with matching ID", data: sealed,
+			ring: &keyring{primary: otherKey, keys: map[string][]byte{string(keyID(key)): otherKey}}},
+		{name: "tampered ciphertext", data: flipLastByte(sealed), ring: ring},
+		{name: "tampered header", data: flipByte(sealed, len(encryptedMagic)+keyIDSize+1), ring: ring},
+		{name: "truncated", data: sealed[:len(encryptedMagic)+keyIDSize+4], ring: ring},
+	}
+	for _, tt := range tests {
+		_, err := decryptData(tt.data, tt.ring)
+		if err == nil {
+			t.Errorf("%s: decryptData succeeded, want an error", tt.name)
+		} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// flipByte returns a copy of data with one byte changed
+func flipByte(data []byte, i int) []byte {
+	out := append([]byte(nil), data...)
+	out[i] ^= 0xFF
+	return out
+}
+
+// flipLastByte returns a copy of data with its final byte changed
+func flipLastByte(data []byte) []byte {
+	return flipByte(data, len(data)-1)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key, oldKey := newTestKey(t), newTestKey(t)
+	encode := base64.StdEncoding.EncodeToString
+
+	t.Run("DATA_KEY", func(t *testing.T) {
+		useTestKeys(t, key, oldKey)
+		if !bytes.Equal(dataKeys.primary, key) || len(dataKeys.keys) != 2 {
+			t.Errorf("keyring has primary %x and %d keys, want the first key and 2 keys", dataKeys.primary, len(dataKeys.keys))
+		}
+	})
+
+	t.Run("DATA_KEY_FILE wins and skips comments", func(t *testing.T) {
+		useTestKeys(t)
+		path := filepath.Join(t.TempDir(), "keys")
+		os.WriteFile(path, []byte("# rotated 2026-10-01\n\n"+encode(oldKey)+"\n  "+encode(key)+"  \n"), 0600)
+		t.Setenv("DATA_KEY_FILE", path)
+		t.Setenv("DATA_KEY", encode(newTestKey(t)))
+		if err := loadKeyring(); err != nil {
+			t.Fatalf("loadKeyring: %v", err)
+		}
+		if !bytes.Equal(dataKeys.primary, oldKey) || len(dataKeys.keys) != 2 {
+			t.Errorf("keyring has primary %x and %d keys, want the file's first key and 2 keys", dataKeys.primary, len(dataKeys.keys))
+		}
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		useTestKeys(t)
+		if dataKeys != nil {
+			t.Error("keyring loaded without any keys")
+		}
+	})
+
+	invalid := []struct {
+		name  string
+		value string
+	}{
+		{name: "not base64", value: "not base64!"},
+		{name: "too short", value: encode([]byte("too short"))},
+		{name: "one bad key in the list", value: encode(key) + ",bad"},
+	}
+	for _, tt := range invalid {
+		t.Run("invalid "+tt.name, func(t *testing.T) {
+			useTestKeys(t)
+			t.Setenv("DATA_KEY", tt.value)
+			if err := loadKeyring(); err == nil {
+				t.Errorf("loadKeyring(%q) succeeded, want an error", tt.value)
+			}
+		})
+	}
+}
+
+func TestEncryptedJSONFiles(t *testing.T) {
+	useTempDataFiles(t)
+	key := newTestKey(t)
+	views := []PageView{{ID: "1", WebsiteID: "site", PageURL: "https://example.com/private"}}
+
+	// Plaintext written before encryption was enabled stays readable and is encrypted on the next write
+	useTestKeys(t)
+	if err := writeJSONFile(pageViewsFile, views); err != nil {
+		t.Fatal(err)
+	}
+	useTestKeys(t, key)
+	var read []PageView
+	if err := readJSONFile(pageViewsFile, &read); err != nil || len(read) != 1 {
+		t.Fatalf("reading plaintext with a key configured = %v, %v", read, err)
+	}
+	if err := writeJSONFile(pageViewsFile, views); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(pageViewsFile)
+	if !isEncrypted(data) {
+		t.Fatal("page views were not encrypted")
+	}
+	if err := checkEncryptedFiles(); err != nil {
+		t.Errorf("checkEncryptedFiles with the right key: %v", err)
+	}
+
+	// Files outside encryptedFiles stay readable
+	other := filepath.Join(filepath.Dir(pageViewsFile), "websites.json")
+	writeJSONFile(other, []Website{{ID: "site"}})
+	if data, _ := os.ReadFile(other); isEncrypted(data) {
+		t.Error("a file not listed in encryptedFiles was encrypted")
+	}
+
+	// Without the key: the server refuses to start and never overwrites the data with plaintext
+	useTestKeys(t)
+	if err := checkEncryptedFiles(); !errors.Is(err, errNoDataKey) {
+		t.Errorf("checkEncryptedFiles without a key = %v, want errNoDataKey", err)
+	}
+	if err := readJSONFile(pageViewsFile, &read); !errors.Is(err, errNoDataKey) {
+		t.Errorf("readJSONFile without a key = %v, want errNoDataKey", err)
+	}
+	if err := writeJSONFile(pageViewsFile, []PageView{}); !errors.Is(err, errPlaintextOverEncrypted) {
+		t.Errorf("writeJSONFile without a key = %v, want errPlaintextOverEncrypted", err)
+	}
+	if data, _ := os.ReadFile(pageViewsFile); !isEncrypted(data) {
+		t.Error("encrypted page views were replaced")
+	}
+	if err := updatePageViews(func(pv []PageView) []PageView { return nil }); err == nil {
+		t.Error("updatePageViews without a key succeeded")
+	}
+
+	// With a different key the check fails as well
+	useTestKeys(t, newTestKey(t))
+	if err := checkEncryptedFiles(); err == nil {
+		t.Error("checkEncryptedFiles with the wrong key succeeded")
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	useTempDataFiles(t)
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	views := []PageView{{ID: "1", WebsiteID: "site"}, {ID: "2", WebsiteID: "site"}}
+
+	useTestKeys(t, oldKey)
+	if err := writeJSONFile(pageViewsFile, views); err != nil {
+		t.Fatal(err)
+	}
+	salt, err := todaysSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key goes first; the old one is still accepted for reading
+	useTestKeys(t, newKey, oldKey)
+	var read []PageView
+	if err := readJSONFile(pageViewsFile, &read); err != nil || len(read) != 2 {
+		t.Fatalf("reading old data after adding a new key = %v, %v", read, err)
+	}
+	if err := runRotateKey(nil); err != nil {
+		t.Fatalf("runRotateKey: %v", err)
+	}
+	for _, filename := range []string{pageViewsFile, saltFile} {
+		data, _ := os.ReadFile(filename)
+		if !isEncrypted(data) || !bytes.Equal(data[len(encryptedMagic):len(encryptedMagic)+keyIDSize], keyID(newKey)) {
+			t.Errorf("%s is not encrypted with the new key after rotation", filepath.Base(filename))
+		}
+	}
+
+	// The old key can now be removed
+	useTestKeys(t, newKey)
+	currentSalt = dailySalt{}
+	if err := checkEncryptedFiles(); err != nil {
+		t.Errorf("checkEncryptedFiles after removing the old key: %v", err)
+	}
+	if err := readJSONFile(pageViewsFile, &read); err != nil || len(read) != 2 {
+		t.Errorf("reading rotated data = %v, %v", read, err)
+	}
+	if got, err := todaysSalt(); err != nil || got != salt {
+		t.Errorf("todaysSalt after rotation = %q, %v; want the same salt", got, err)
+	}
+
+	// Rotation needs a key
+	useTestKeys(t)
+	if err := runRotateKey(nil); err == nil {
+		t.Error("runRotateKey without a key succeeded")
+	}
+}
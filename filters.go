@@ -0,0 +1,276 @@
+package main
+
+import (
+	"net/url" // For extracting page paths
+	"regexp"  // For parsing filter expressions and regex filters
+	"strings" // For string manipulation
+)
+
+// =============================================================================
+// DIMENSIONS AND FILTERS
+// =============================================================================
+
+// dimensionNames lists every dimension that can be filtered on (and broken down by)
+// "property:<name>" selects a custom event property and is handled separately
+var dimensionNames = map[string]bool{
+	"page": true, "url": true, "title": true, "hostname": true,
+	"referrer": true, "source": true, "channel": true,
+	"browser": true, "browser_version": true, "os": true, "os_version": true, "device": true,
+	"country": true, "region": true, "city": true,
+	"utm_source": true, "utm_medium": true, "utm_campaign": true, "utm_term": true, "utm_content": true,
+	"event": true, "mode": true, "goal": true,
+}
+
+// propertyPrefix selects a custom event property dimension (e.g., "property:plan")
+const propertyPrefix = "property:"
+
+// validDimension reports whether a name is a known dimension or a property dimension
+func validDimension(dimension string) bool {
+	if name, ok := strings.CutPrefix(dimension, propertyPrefix); ok {
+		return name != ""
+	}
+	return dimensionNames[dimension]
+}
+
+// isEventDimension reports whether a dimension describes conversions rather than page views
+// Filters on these dimensions select whole sessions (see applyFilters)
+func isEventDimension(dimension string) bool {
+	return dimension == "event" || dimension == "goal" || strings.HasPrefix(dimension, propertyPrefix)
+}
+
+// pagePath returns the path of a page URL, defaulting to "/"
+func pagePath(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// dimensionValue returns a page view's value for a dimension
+// Derived dimensions (source, channel) need the website to recognize self-referrals
+func dimensionValue(pv PageView, dimension string, website Website) string {
+	if name, ok := strings.CutPrefix(dimension, propertyPrefix); ok {
+		return pv.Props[name]
+	}
+	switch dimension {
+	case "page":
+		return pagePath(pv.PageURL)
+	case "url":
+		return pv.PageURL
+	case "title":
+		return pv.PageTitle
+	case "hostname":
+		return normalizeHost(pv.PageURL)
+	case "referrer":
+		return normalizeHost(pv.Referrer)
+	case "source":
+		return referrerSource(pv, website)
+	case "channel":
+		return trafficChannel(pv, website)
+	case "browser":
+		return pv.Browser
+	case "browser_version":
+		return pv.BrowserVersion
+	case "os":
+		return pv.OS
+	case "os_version":
+		return pv.OSVersion
+	case "device":
+		return pv.Device
+	case "country":
+		return pv.Country
+	case "region":
+		return pv.Region
+	case "city":
+		return pv.City
+	case "utm_source":
+		return pv.UTMSource
+	case "utm_medium":
+		return pv.UTMMedium
+	case "utm_campaign":
+		return pv.UTMCampaign
+	case "utm_term":
+		return pv.UTMTerm
+	case "utm_content":
+		return pv.UTMContent
+	case "event":
+		return pv.Event
+	case "mode":
+		return pv.TrackingMode
+	case "goal":
+		// A record can complete several goals; this is the first one (filters test them all)
+		if goals := completedGoals(pv, website); len(goals) > 0 {
+			return goals[0]
+		}
+	}
+	return ""
+}
+
+// Filter is a single condition on a dimension, parsed from "filter=<dimension><operator><value>"
+//
+//	==  equals (a "*" in the value matches any characters, e.g. page==/blog/*)
+//	!=  does not equal
+//	=@  contains (case-insensitive)
+//	!@  does not contain
+//	=~  matches a regular expression
+//	!~  does not match a regular expression
+type Filter struct {
+	Dimension string         // Dimension to test (e.g., "page", "property:plan")
+	Operator  string         // One of the operators above
+	Value     string         // Value to compare against
+	pattern   *regexp.Regexp // Compiled pattern for regex operators
+	glob      wildcard       // Compiled value for == and !=
+}
+
+// filterPattern splits a filter expression into dimension, operator and value
+var filterPattern = regexp.MustCompile(`^([a-zA-Z0-9_:.\-]+?)(==|!=|=@|!@|=~|!~)(.*)$`)
+
+// parseFilters parses every "filter" query parameter; all filters must match (AND)
+func parseFilters(expressions []string) ([]Filter, error) {
+	var filters []Filter
+	for _, expr := range expressions {
+		if expr == "" {
+			continue // Empty parameters come from blank form fields
+		}
+		match := filterPattern.FindStringSubmatch(expr)
+		if match == nil {
+			return nil, badQuery("invalid filter %q: use <dimension><op><value> with op ==, !=, =@, !@, =~ or !~", expr)
+		}
+		f := Filter{Dimension: match[1], Operator: match[2], Value: match[3]}
+		if !validDimension(f.Dimension) {
+			return nil, badQuery("unknown filter dimension %q", f.Dimension)
+		}
+		if f.Operator == "=~" || f.Operator == "!~" {
+			pattern, err := regexp.Compile(f.Value)
+			if err != nil {
+				return nil, badQuery("invalid regular expression in filter %q: %v", expr, err)
+			}
+			f.pattern = pattern
+		} else if f.Operator == "==" || f.Operator == "!=" {
+			f.glob = compileWildcard(f.Value)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// negated reports whether the operator is a negation of a positive condition
+func (f Filter) negated() bool {
+	return strings.HasPrefix(f.Operator, "!")
+}
+
+// matches tests the positive form of the condition against a single record
+// A goal condition matches if any goal the record completes matches
+func (f Filter) matches(pv PageView, website Website) bool {
+	if f.Dimension == "goal" {
+		for _, name := range completedGoals(pv, website) {
+			if f.matchesValue(name) {
+				return true
+			}
+		}
+		return false
+	}
+	return f.matchesValue(dimensionValue(pv, f.Dimension, website))
+}
+
+// matchesValue tests the positive form of the condition against a value (negation is applied by the caller)
+func (f Filter) matchesValue(value string) bool {
+	switch f.Operator {
+	case "==", "!=":
+		return f.glob.match(value)
+	case "=@", "!@":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(f.Value))
+	default:
+		return f.pattern.MatchString(value)
+	}
+}
+
+// wildcard is a pattern where "*" matches any run of characters, including "/"
+// It is compiled once, when the filter, goal or funnel step using it is parsed, and then
+// tested against every record
+type wildcard struct {
+	pattern string         // Pattern as configured
+	re      *regexp.Regexp // Compiled form; nil when the pattern has no "*" and is compared exactly
+}
+
+// compileWildcard compiles a "*" pattern
+func compileWildcard(pattern string) wildcard {
+	w := wildcard{pattern: pattern}
+	if !strings.Contains(pattern, "*") {
+		return w
+	}
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	// Every literal part is quoted, so the expression always compiles
+	w.re = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+	return w
+}
+
+// match reports whether value matches the whole pattern
+func (w wildcard) match(value string) bool {
+	if w.re == nil {
+		return value == w.pattern
+	}
+	return w.re.MatchString(value)
+}
+
+// matchesFilters reports whether a single record satisfies every filter on its own values
+// Unlike applyFilters it cannot see the rest of the session, so event dimensions only match the
+// record itself; it is used where records arrive one at a time, such as the live stream.
+func matchesFilters(pv PageView, filters []Filter, website Website) bool {
+	for _, f := range filters {
+		if f.matches(pv, website) == f.negated() {
+			return false
+		}
+	}
+	return true
+}
+
+// applyFilters keeps the page views that satisfy every filter
+// Page-level dimensions are tested on each record. Event dimensions (event, goal, property:*) are
+// tested on the session: e.g. event==signup keeps every record from sessions that signed up,
+// and event!=signup keeps every record from sessions that did not.
+func applyFilters(pageViews []PageView, filters []Filter, website Website) []PageView {
+	if len(filters) == 0 {
+		return pageViews
+	}
+
+	// For each event filter, find the sessions containing a matching record
+	sessionMatches := make([]map[string]bool, len(filters))
+	for i, f := range filters {
+		if !isEventDimension(f.Dimension) {
+			continue
+		}
+		sessionMatches[i] = make(map[string]bool)
+		for _, pv := range pageViews {
+			if pv.SessionID != "" && f.matches(pv, website) {
+				sessionMatches[i][pv.SessionID] = true
+			}
+		}
+	}
+
+	var kept []PageView
+	for _, pv := range pageViews {
+		keep := true
+		for i, f := range filters {
+			var matched bool
+			if sessionMatches[i] != nil && pv.SessionID != "" {
+				matched = sessionMatches[i][pv.SessionID]
+			} else {
+				// Records without a session (anonymous hits) can only match on their own values
+				matched = f.matches(pv, website)
+			}
+			if matched == f.negated() {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, pv)
+		}
+	}
+	return kept
+}
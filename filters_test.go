@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"  // For classifying query errors
+	"strings" // For joining kept record IDs
+	"testing" // For the test runner
+)
+
+// =============================================================================
+// FILTER PARSING TESTS
+// =============================================================================
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		expr      string
+		dimension string
+		operator  string
+		value     string
+	}{
+		{expr: "page==/blog/*", dimension: "page", operator: "==", value: "/blog/*"},
+		{expr: "country!=DE", dimension: "country", operator: "!=", value: "DE"},
+		{expr: "title=@Pricing", dimension: "title", operator: "=@", value: "Pricing"},
+		{expr: "browser!@edge", dimension: "browser", operator: "!@", value: "edge"},
+		{expr: "page=~^/docs/v[0-9]+/", dimension: "page", operator: "=~", value: "^/docs/v[0-9]+/"},
+		{expr: "utm_source!~^news", dimension: "utm_source", operator: "!~", value: "^news"},
+		{expr: "property:plan==pro", dimension: "property:plan", operator: "==", value: "pro"},
+		{expr: "event==", dimension: "event", operator: "==", value: ""}, // Empty value: page views only
+		// The value may contain operator characters; the first operator splits the expression
+		{expr: "url==https://example.com/?a==b", dimension: "url", operator: "==", value: "https://example.com/?a==b"},
+	}
+	for _, tt := range tests {
+		filters, err := parseFilters([]string{tt.expr})
+		if err != nil {
+			t.Errorf("parseFilters(%q): %v", tt.expr, err)
+			continue
+		}
+		if len(filters) != 1 {
+			t.Errorf("parseFilters(%q) returned %d filters, want 1", tt.expr, len(filters))
+			continue
+		}
+		f := filters[0]
+		if f.Dimension != tt.dimension || f.Operator != tt.operator || f.Value != tt.value {
+			t.Errorf("parseFilters(%q) = %s %s %q, want %s %s %q",
+				tt.expr, f.Dimension, f.Operator, f.Value, tt.dimension, tt.operator, tt.value)
+		}
+		if isRegex := f.Operator == "=~" || f.Operator == "!~"; isRegex != (f.pattern != nil) {
+			t.Errorf("parseFilters(%q): compiled pattern = %v, want one only for regex operators", tt.expr, f.pattern)
+		}
+	}
+
+	// Blank parameters (from empty form fields) are ignored
+	filters, err := parseFilters([]string{"", "page==/", ""})
+	if err != nil || len(filters) != 1 {
+		t.Errorf("parseFilters with blanks = %v, %v; want one filter", filters, err)
+	}
+}
+
+func TestParseFiltersErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "no operator", expr: "page"},
+		{name: "single equals", expr: "page=/blog"},
+		{name: "missing dimension", expr: "==/blog"},
+		{name: "unknown dimension", expr: "colour==red"},
+		{name: "empty property name", expr: "property:==pro"},
+		{name: "invalid regular expression", expr: "page=~/docs/(v1"},
+	}
+	for _, tt := range tests {
+		_, err := parseFilters([]string{"page==/", tt.expr})
+		var qe *queryError
+		if !errors.As(err, &qe) {
+			t.Errorf("%s: parseFilters(%q) = %v, want a queryError (400)", tt.name, tt.expr, err)
+		}
+	}
+}
+
+// =============================================================================
+// FILTER MATCHING TESTS
+// =============================================================================
+
+// filterTestViews is a small site history: session s1 signs up, s2 only browses,
+// and the last two records were sent without a session
+var filterTestViews = []PageView{
+	{ID: "1", SessionID: "s1", PageURL: "https://example.com/", PageTitle: "Home", Country: "DE"},
+	{ID: "2", SessionID: "s1", PageURL: "https://example.com/pricing", PageTitle: "Pricing Plans", Country: "DE"},
+	{ID: "3", SessionID: "s1", PageURL: "https://example.com/pricing", Event: "signup", Props: map[string]string{"plan": "pro"}},
+	{ID: "4", SessionID: "s2", PageURL: "https://example.com/blog/2026/launch", PageTitle: "Launch", Country: "US"},
+	{ID: "5", SessionID: "s2", PageURL: "https://example.com/blog/", PageTitle: "Blog", Country: "US"},
+	{ID: "6", PageURL: "https://example.com/docs/v2/start", Country: "FR"},
+	{ID: "7", PageURL: "https://example.com/pricing", Event: "signup", Props: map[string]string{"plan": "free"}},
+}
+
+// keptIDs lists the IDs of records in order, e.g. "1,2,3"
+func keptIDs(pageViews []PageView) string {
+	ids := make([]string, len(pageViews))
+	for i, pv := range pageViews {
+		ids[i] = pv.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestApplyFilters(t *testing.T) {
+	website := Website{ID: "site", Goals: []Goal{
+		{Name: "Visited pricing", Page: "/pricing"},
+		{Name: "Pro signup", Event: "signup", Props: map[string]string{"plan": "pro"}},
+	}}
+
+	tests := []struct {
+		name    string
+		filters []string
+		want    string
+	}{
+		{name: "no filters", filters: nil, want: "1,2,3,4,5,6,7"},
+		{name: "exact page", filters: []string{"page==/pricing"}, want: "2,3,7"},
+		{name: "wildcard spans slashes", filters: []string{"page==/blog/*"}, want: "4,5"},
+		{name: "page does not equal", filters: []string{"page!=/pricing"}, want: "1,4,5,6"},
+		{name: "contains is case-insensitive", filters: []string{"title=@pricing"}, want: "2"},
+		{name: "does not contain", filters: []string{"title!@n"}, want: "1,3,5,6,7"},
+		{name: "regular expression", filters: []string{"page=~^/docs/v[0-9]+/"}, want: "6"},
+		{name: "negated regular expression", filters: []string{"page!~^/(blog|docs)/"}, want: "1,2,3,7"},
+		{name: "filters are combined with AND", filters: []string{"page==/blog/*", "title==Blog"}, want: "5"},
+		// Event dimensions select whole sessions; anonymous records match on their own values
+		{name: "event keeps converting sessions", filters: []string{"event==signup"}, want: "1,2,3,7"},
+		{name: "negated event keeps the other sessions", filters: []string{"event!=signup"}, want: "4,5,6"},
+		{name: "property", filters: []string{"property:plan==pro"}, want: "1,2,3"},
+		{name: "negated property", filters: []string{"property:plan!=pro"}, want: "4,5,6,7"},
+		{name: "goal", filters: []string{"goal==Pro signup"}, want: "1,2,3"},
+		{name: "page goal matches page views only", filters: []string{"goal==Visited pricing"}, want: "1,2,3"},
+		{name: "session and page filters together", filters: []string{"event==signup", "country==DE"}, want: "1,2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := parseFilters(tt.filters)
+			if err != nil {
+				t.Fatalf("parseFilters: %v", err)
+			}
+			if got := keptIDs(applyFilters(filterTestViews, filters, website)); got != tt.want {
+				t.Errorf("applyFilters(%q) kept %s, want %s", tt.filters, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesFilters(t *testing.T) {
+	website := Website{ID: "site"}
+	tests := []struct {
+		filters []string
+		want    string
+	}{
+		{filters: []string{"page==/pricing"}, want: "2,3,7"},
+		// Without the rest of the session, event filters only see the record itself
+		{filters: []string{"event==signup"}, want: "3,7"},
+		{filters: []string{"event!=signup"}, want: "1,2,4,5,6"},
+		{filters: []string{"property:plan==pro", "page==/pricing"}, want: "3"},
+	}
+	for _, tt := range tests {
+		filters, err := parseFilters(tt.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var kept []PageView
+		for _, pv := range filterTestViews {
+			if matchesFilters(pv, filters, website) {
+				kept = append(kept, pv)
+			}
+		}
+		if got := keptIDs(kept); got != tt.want {
+			t.Errorf("matchesFilters(%q) kept %s, want %s", tt.filters, got, tt.want)
+		}
+	}
+}
+
+func TestCompileWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: "/pricing", value: "/pricing", want: true},
+		{pattern: "/pricing", value: "/pricing/", want: false},
+		{pattern: "/blog/*", value: "/blog/2026/launch", want: true}, // "*" spans slashes
+		{pattern: "/blog/*", value: "/blog/", want: true},
+		{pattern: "/blog/*", value: "/blogs/", want: false},
+		{pattern: "*.pdf", value: "/files/report.pdf", want: true},
+		{pattern: "/docs/*/install", value: "/docs/v2/install", want: true},
+		{pattern: "/docs/*/install", value: "/docs/v2/install/linux", want: false},
+		// Regular expression characters in the pattern are literal
+		{pattern: "/a+b(1)*", value: "/a+b(1)/x", want: true},
+		{pattern: "/a+b(1)*", value: "/aab1/x", want: false},
+		{pattern: "*", value: "", want: true},
+		{pattern: "", value: "", want: true},
+	}
+	for _, tt := range tests {
+		w := compileWildcard(tt.pattern)
+		if got := w.match(tt.value); got != tt.want {
+			t.Errorf("compileWildcard(%q).match(%q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+		if hasStar := strings.Contains(tt.pattern, "*"); hasStar != (w.re != nil) {
+			t.Errorf("compileWildcard(%q) compiled a regexp: %v, want %v", tt.pattern, w.re != nil, hasStar)
+		}
+	}
+
+	// Filters compile their value once, when parsed
+	filters, _ := parseFilters([]string{"page==/blog/*"})
+	if filters[0].glob.re == nil {
+		t.Error("parseFilters did not compile the wildcard")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json" // For encoding the response
+	"log"           // For reporting invalid funnel configuration
+	"net/http"      // For the funnel handler
+	"time"          // For the maximum time between steps
+)
+
+// =============================================================================
+// FUNNELS
+// =============================================================================
+
+// Funnel is an ordered sequence of steps configured on a website in websites.json
+// Each step is matched like a goal (a page path or a custom event), e.g.:
+//
+//	{"name": "Signup", "max_step_time": "30m", "steps": [
+//	  {"name": "Pricing", "page": "/pricing"},
+//	  {"name": "Form", "page": "/signup"},
+//	  {"name": "Completed", "event": "signup_completed"}]}
+type Funnel struct {
+	Name        string `json:"name"`                    // Name shown in reports
+	Steps       []Goal `json:"steps"`                   // Steps in the order visitors must complete them
+	MaxStepTime string `json:"max_step_time,omitempty"` // Optional Go duration (e.g. "30m") allowed between consecutive steps
+}
+
+// FunnelStepRow reports how many sessions reached one step of a funnel
+type FunnelStepRow struct {
+	Name               string  `json:"name"`                 // Step name
+	Entrants           int     `json:"entrants"`             // Sessions that reached this step (having completed all earlier steps)
+	DropOff            int     `json:"drop_off"`             // Sessions that reached the previous step but not this one
+	ConversionRate     float64 `json:"conversion_rate"`      // Percentage of the first step's entrants that reached this step
+	StepConversionRate float64 `json:"step_conversion_rate"` // Percentage of the previous step's entrants that reached this step
+}
+
+// FunnelReport is the result for a single funnel
+type FunnelReport struct {
+	Name  string          `json:"name"`
+	Steps []FunnelStepRow `json:"steps"`
+}
+
+// Funnels is the response of the /stats/{trackingId}/funnels endpoint
+type Funnels struct {
+	Range   DateRange      `json:"range"`   // Reporting period
+	Funnels []FunnelReport `json:"funnels"` // One report per configured funnel
+}
+
+// stepName labels a step by its name, falling back to the page or event it matches
+func stepName(step Goal) string {
+	switch {
+	case step.Name != "":
+		return step.Name
+	case step.Event != "":
+		return step.Event
+	default:
+		return step.Page
+	}
+}
+
+// maxStepTime parses the funnel's time limit between steps; 0 means no limit
+func (f Funnel) maxStepTime() time.Duration {
+	if f.MaxStepTime == "" {
+		return 0
+	}
+	limit, err := time.ParseDuration(f.MaxStepTime)
+	if err != nil || limit < 0 {
+		log.Printf("Funnel %q has invalid max_step_time %q, ignoring it", f.Name, f.MaxStepTime)
+		return 0
+	}
+	return limit
+}
+
+// stepsReached returns how many of the funnel's steps a session completed in order
+// Other pages and events may occur between steps. With a time limit, each step must follow the
+// most recent completion of the previous step within the limit; repeating the previous step resets the clock.
+func (f Funnel) stepsReached(s session, limit time.Duration) int {
+	reached := 0
+	var last time.Time
+	for _, pv := range s.Views {
+		if reached == len(f.Steps) {
+			break
+		}
+		if f.Steps[reached].matches(pv) && (reached == 0 || limit == 0 || pv.Timestamp.Sub(last) <= limit) {
+			reached++
+			last = pv.Timestamp
+			continue
+		}
+		if reached > 0 && f.Steps[reached-1].matches(pv) {
+			last = pv.Timestamp
+		}
+	}
+	return reached
+}
+
+// funnelReport counts the sessions reaching each step of a funnel
+func funnelReport(f Funnel, sessions []session) FunnelReport {
+	report := FunnelReport{Name: f.Name, Steps: []FunnelStepRow{}}
+	limit := f.maxStepTime()
+
+	// entrants[i] is the number of sessions that completed at least i+1 steps
+	entrants := make([]int, len(f.Steps))
+	for _, s := range sessions {
+		reached := f.stepsReached(s, limit)
+		for i := 0; i < reached; i++ {
+			entrants[i]++
+		}
+	}
+
+	for i, step := range f.Steps {
+		row := FunnelStepRow{Name: stepName(step), Entrants: entrants[i]}
+		if i > 0 {
+			row.DropOff = entrants[i-1] - entrants[i]
+			if entrants[i-1] > 0 {
+				row.StepConversionRate = float64(entrants[i]) * 100 / float64(entrants[i-1])
+			}
+		} else if entrants[0] > 0 {
+			row.StepConversionRate = 100
+		}
+		if entrants[0] > 0 {
+			row.ConversionRate = float64(entrants[i]) * 100 / float64(entrants[0])
+		}
+		report.Steps = append(report.Steps, row)
+	}
+	return report
+}
+
+// funnelsHandler serves step-by-step conversion for each of the website's funnels
+// Accepts the usual period and filter parameters
+func funnelsHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	// Filters select sessions; a selected session keeps every step it reached
+	records, err := loadSessionRecords(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	// Steps can be custom events, so sessions include every record, not just page views
+	sessions := groupSessions(records)
+	response := Funnels{Range: query.dateRange(), Funnels: []FunnelReport{}}
+	for _, f := range query.Website.Funnels {
+		response.Funnels = append(response.Funnels, funnelReport(f, sessions))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing" // For the test runner
+	"time"    // For spacing out test steps
+)
+
+// =============================================================================
+// FUNNEL TESTS
+// =============================================================================
+
+// funnelStep is one record of a test session: a page path or an event, some minutes after the start
+type funnelStep struct {
+	minutes int
+	page    string
+	event   string
+}
+
+// testSession builds a session from steps, in the order given
+func testSession(id string, steps ...funnelStep) session {
+	start := time.Date(2026, 9, 18, 10, 0, 0, 0, time.UTC)
+	s := session{ID: id}
+	for _, step := range steps {
+		s.Views = append(s.Views, PageView{
+			SessionID: id,
+			Timestamp: start.Add(time.Duration(step.minutes) * time.Minute),
+			PageURL:   "https://example.com" + step.page,
+			Event:     step.event,
+		})
+	}
+	return s
+}
+
+// signupFunnel is pricing page -> signup page -> signup event
+var signupFunnel = Funnel{Name: "Signup", Steps: []Goal{
+	{Name: "Pricing", Page: "/pricing"},
+	{Page: "/signup"},
+	{Event: "signup"},
+}}
+
+func TestStepsReached(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   time.Duration
+		session session
+		want    int
+	}{
+		{name: "all steps", session: testSession("s",
+			funnelStep{0, "/pricing", ""}, funnelStep{1, "/signup", ""}, funnelStep{2, "/signup", "signup"}), want: 3},
+		{name: "other pages between steps", session: testSession("s",
+			funnelStep{0, "/", ""}, funnelStep{1, "/pricing", ""}, funnelStep{2, "/faq", ""}, funnelStep{3, "/signup", ""}), want: 2},
+		{name: "steps out of order", session: testSession("s",
+			funnelStep{0, "/signup", ""}, funnelStep{1, "/pricing", ""}), want: 1},
+		{name: "first step never reached", session: testSession("s",
+			funnelStep{0, "/signup", ""}, funnelStep{1, "/signup", "signup"}), want: 0},
+		// A 404 on a step's page is not a page view of it
+		{name: "not-found page", session: testSession("s",
+			funnelStep{0, "/pricing", eventNotFound}, funnelStep{1, "/signup", ""}), want: 0},
+		{name: "within the time limit", limit: 10 * time.Minute, session: testSession("s",
+			funnelStep{0, "/pricing", ""}, funnelStep{10, "/signup", ""}, funnelStep{20, "/", "signup"}), want: 3},
+		{name: "too slow for the time limit", limit: 10 * time.Minute, session: testSession("s",
+			funnelStep{0, "/pricing", ""}, funnelStep{11, "/signup", ""}), want: 1},
+		// Repeating the previous step restarts the clock for the next one
+		{name: "repeated step resets the clock", limit: 10 * time.Minute, session: testSession("s",
+			funnelStep{0, "/pricing", ""}, funnelStep{8, "/pricing", ""}, funnelStep{16, "/signup", ""}), want: 2},
+		{name: "no limit", session: testSession("s",
+			funnelStep{0, "/pricing", ""}, funnelStep{600, "/signup", ""}), want: 2},
+	}
+	for _, tt := range tests {
+		if got := signupFunnel.stepsReached(tt.session, tt.limit); got != tt.want {
+			t.Errorf("%s: stepsReached = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFunnelReport(t *testing.T) {
+	sessions := []session{
+		testSession("a", funnelStep{0, "/pricing", ""}, funnelStep{1, "/signup", ""}, funnelStep{2, "/signup", "signup"}),
+		testSession("b", funnelStep{0, "/pricing", ""}, funnelStep{1, "/signup", ""}),
+		testSession("c", funnelStep{0, "/pricing", ""}, funnelStep{45, "/signup", ""}), // Too slow with a 30m limit
+		testSession("d", funnelStep{0, "/pricing", ""}),
+		testSession("e", funnelStep{0, "/", ""}),
+	}
+
+	tests := []struct {
+		name        string
+		maxStepTime string
+		want        []FunnelStepRow
+	}{
+		{name: "no limit", want: []FunnelStepRow{
+			{Name: "Pricing", Entrants: 4, DropOff: 0, ConversionRate: 100, StepConversionRate: 100},
+			{Name: "/signup", Entrants: 3, DropOff: 1, ConversionRate: 75, StepConversionRate: 75},
+			{Name: "signup", Entrants: 1, DropOff: 2, ConversionRate: 25, StepConversionRate: 100.0 / 3},
+		}},
+		{name: "30 minute limit", maxStepTime: "30m", want: []FunnelStepRow{
+			{Name: "Pricing", Entrants: 4, DropOff: 0, ConversionRate: 100, StepConversionRate: 100},
+			{Name: "/signup", Entrants: 2, DropOff: 2, ConversionRate: 50, StepConversionRate: 50},
+			{Name: "signup", Entrants: 1, DropOff: 1, ConversionRate: 25, StepConversionRate: 50},
+		}},
+		// An invalid limit is logged and ignored
+		{name: "invalid limit", maxStepTime: "soon", want: []FunnelStepRow{
+			{Name: "Pricing", Entrants: 4, ConversionRate: 100, StepConversionRate: 100},
+			{Name: "/signup", Entrants: 3, DropOff: 1, ConversionRate: 75, StepConversionRate: 75},
+			{Name: "signup", Entrants: 1, DropOff: 2, ConversionRate: 25, StepConversionRate: 100.0 / 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := signupFunnel
+			f.MaxStepTime = tt.maxStepTime
+			report := funnelReport(f, sessions)
+			if report.Name != "Signup" || len(report.Steps) != len(tt.want) {
+				t.Fatalf("funnelReport = %+v", report)
+			}
+			for i, row := range report.Steps {
+				if row != tt.want[i] {
+					t.Errorf("step %d = %+v, want %+v", i, row, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Nobody entered: every rate is 0 rather than NaN
+	report := funnelReport(signupFunnel, nil)
+	for i, row := range report.Steps {
+		if row != (FunnelStepRow{Name: row.Name}) {
+			t.Errorf("empty funnel step %d = %+v, want all zeros", i, row)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/sha256" // For hashing identifiers in the audit log
+	"crypto/subtle" // For constant-time token comparison
+	"encoding/hex"  // For encoding identifier hashes
+	"encoding/json" // For audit entries and API responses
+	"errors"        // For sentinel errors
+	"flag"          // For parsing command flags
+	"fmt"           // For error formatting
+	"log"           // For logging audit failures
+	"net/http"      // For the admin API
+	"os"            // For the audit log and command output
+	"path/filepath" // For building the audit log path
+	"strings"       // For parsing the Authorization header
+	"time"          // For audit timestamps
+)
+
+// =============================================================================
+// DATA SUBJECT REQUESTS (GDPR ACCESS AND ERASURE)
+// =============================================================================
+
+// auditLogFile records every data subject export and deletion as one JSON object per line
+var auditLogFile = filepath.Join(dataDir, "audit.log")
+
+// errEmptySubjectQuery is returned when no identifier was given, which would otherwise match everything
+var errEmptySubjectQuery = errors.New("at least one of session_id, visitor_id, user_id or ip is required")
+
+// SubjectQuery identifies the page views belonging to one data subject
+// A page view matches if any of the given identifiers match
+type SubjectQuery struct {
+	SessionID string `json:"session_id,omitempty"`
+	VisitorID string `json:"visitor_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"` // The ID the website passed to Analytics.identify (not the stored hash)
+	IP        string `json:"ip,omitempty"`
+	WebsiteID string `json:"website_id,omitempty"` // Optional: limit the search to one website
+}
+
+// AuditEntry is a single line of the audit log
+type AuditEntry struct {
+	Time    time.Time    `json:"time"`    // When the operation ran
+	Action  string       `json:"action"`  // "export" or "delete"
+	Source  string       `json:"source"`  // "api" or "cli"
+	Query   SubjectQuery `json:"query"`   // Identifiers searched for, hashed (IP truncated to its network)
+	Records int          `json:"records"` // Number of page views exported or deleted
+}
+
+// SubjectExport is the document returned for an access request
+type SubjectExport struct {
+	ExportedAt time.Time    `json:"exported_at"`
+	Query      SubjectQuery `json:"query"`
+	Records    []PageView   `json:"records"`
+}
+
+// empty reports whether the query has no identifiers
+func (q SubjectQuery) empty() bool {
+	return q.SessionID == "" && q.VisitorID == "" && q.UserID == "" && q.IP == ""
+}
+
+// matches reports whether a page view belongs to the data subject
+// Stored IPs are compared as-is and, for hashed storage, against the hash of the given IP.
+// Truncated IPs are shared by a whole network, so they are deliberately not matched.
+func (q SubjectQuery) matches(pv PageView) bool {
+	if q.WebsiteID != "" && pv.WebsiteID != q.WebsiteID {
+		return false
+	}
+	switch {
+	case q.SessionID != "" && pv.SessionID == q.SessionID:
+		return true
+	case q.VisitorID != "" && pv.VisitorID == q.VisitorID:
+		return true
+	case q.UserID != "" && pv.UserID != "" && pv.UserID == userHash(pv.WebsiteID, q.UserID):
+		return true
+	case q.IP != "" && pv.IPAddress != "":
+		return pv.IPAddress == q.IP || pv.IPAddress == anonymizeIP(q.IP, ipModeHash)
+	}
+	return false
+}
+
+// exportSubject returns every stored page view that belongs to the data subject
+func exportSubject(q SubjectQuery) ([]PageView, error) {
+	if q.empty() {
+		return nil, errEmptySubjectQuery
+	}
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return nil, fmt.Errorf("could not read page views: %w", err)
+	}
+	records := []PageView{}
+	for _, pv := range pageViews {
+		if q.matches(pv) {
+			records = append(records, pv)
+		}
+	}
+	return records, nil
+}
+
+// deleteSubject removes every stored page view that belongs to the data subject
+// It returns the number of page views deleted. Backups written by the backup command are not touched:
+// they live at arbitrary paths, possibly offline, so erasing from them is left to the operator.
+func deleteSubject(q SubjectQuery) (int, error) {
+	if q.empty() {
+		return 0, errEmptySubjectQuery
+	}
+	// Filter under the page view lock so a concurrent hit cannot write erased records back
+	var kept []PageView
+	deleted := 0
+	err := updatePageViews(func(pageViews []PageView) []PageView {
+		kept = make([]PageView, 0, len(pageViews))
+		for _, pv := range pageViews {
+			if !q.matches(pv) {
+				kept = append(kept, pv)
+			}
+		}
+		deleted = len(pageViews) - len(kept)
+		return kept
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not delete page views: %w", err)
+	}
+	if deleted > 0 {
+		// The erasure itself is complete at this point, so a failed rebuild is logged rather than
+		// reported as a failed deletion (which would also skip the audit entry)
+		if err := rebuildSubjectSketches(kept); err != nil {
+			log.Printf("Error rebuilding sketches after deletion (run rebuild-sketches): %v", err)
+		}
+	}
+	return deleted, nil
+}
+
+// rebuildSubjectSketches recomputes the sketches after a deletion
+// Sketches hash the deleted IDs into their registers, so every day still backed by page views is rebuilt
+func rebuildSubjectSketches(kept []PageView) error {
+	websites, err := loadWebsiteMap()
+	if err != nil {
+		return fmt.Errorf("could not read websites: %w", err)
+	}
+	return rebuildSketches(kept, websites, "", true)
+}
+
+// auditHash replaces a session or visitor ID with a SHA-256 prefix for the audit log
+// The IDs are random, so the hash cannot be reversed, but an operator holding an ID can still
+// check whether it was erased by hashing it again
+func auditHash(id string) string {
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
+
+// writeAudit appends an entry to the audit log
+// Session and visitor IDs are hashed, the user ID is pseudonymized as in stored page views (or dropped
+// without USER_ID_SECRET) and the IP is truncated first, so the log itself does not retain what was erased
+func writeAudit(action, source string, q SubjectQuery, records int) error {
+	q.SessionID = auditHash(q.SessionID)
+	q.VisitorID = auditHash(q.VisitorID)
+	q.UserID = userHash(q.WebsiteID, q.UserID)
+	if q.IP != "" {
+		q.IP = truncateIP(q.IP)
+	}
+	entry := AuditEntry{Time: time.Now().UTC(), Action: action, Source: source, Query: q, Records: records}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	f, err := os.OpenFile(auditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open audit log: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// requireAdmin checks the request's bearer token against ADMIN_TOKEN
+// The admin API is disabled entirely when ADMIN_TOKEN is not set
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		http.Error(w, "Admin API disabled: set ADMIN_TOKEN to enable it", http.StatusForbidden)
+		return false
+	}
+	// The Bearer scheme is required (case-insensitively, as in RFC 7235); a bare token is rejected
+	scheme, given, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// dataSubjectHandler exports (GET) or deletes (DELETE) all page views for a session ID, visitor ID or IP
+// Identifiers are passed as query parameters: session_id, visitor_id, user_id, ip and optionally website_id
+func dataSubjectHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	q := SubjectQuery{
+		SessionID: query.Get("session_id"),
+		VisitorID: query.Get("visitor_id"),
+		UserID:    query.Get("user_id"),
+		IP:        query.Get("ip"),
+		WebsiteID: query.Get("website_id"),
+	}
+	if q.empty() {
+		http.Error(w, errEmptySubjectQuery.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		records, err := exportSubject(q)
+		if err != nil {
+			http.Error(w, "Server error: could not export records", http.StatusInternalServerError)
+			return
+		}
+		if err := writeAudit("export", "api", q, len(records)); err != nil {
+			log.Printf("Error writing audit log: %v", err)
+		}
+		json.NewEncoder(w).Encode(SubjectExport{ExportedAt: time.Now().UTC(), Query: q, Records: records})
+	case http.MethodDelete:
+		deleted, err := deleteSubject(q)
+		if err != nil {
+			http.Error(w, "Server error: could not delete records", http.StatusInternalServerError)
+			return
+		}
+		if err := writeAudit("delete", "api", q, deleted); err != nil {
+			log.Printf("Error writing audit log: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+	}
+}
+
+// subjectFlags defines the identifier flags shared by the subject-export and subject-delete commands
+func subjectFlags(name string) (*SubjectQuery, *flag.FlagSet) {
+	q := &SubjectQuery{}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&q.SessionID, "session-id", "", "match page views with this session ID")
+	flags.StringVar(&q.VisitorID, "visitor-id", "", "match page views with this visitor ID")
+	flags.StringVar(&q.UserID, "user-id", "", "match page views identified with this user ID")
+	flags.StringVar(&q.IP, "ip", "", "match page views stored with this IP address (full or hashed)")
+	flags.StringVar(&q.WebsiteID, "website", "", "only search this website ID")
+	return q, flags
+}
+
+// runSubjectExport writes all page views for a data subject as JSON to stdout or a file
+func runSubjectExport(args []string) error {
+	q, flags := subjectFlags("subject-export")
+	out := flags.String("out", "", "write the export to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	records, err := exportSubject(*q)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(SubjectExport{ExportedAt: time.Now().UTC(), Query: *q, Records: records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(string(data))
+	} else if err := os.WriteFile(*out, data, 0600); err != nil {
+		return fmt.Errorf("could not write export: %w", err)
+	}
+	return writeAudit("export", "cli", *q, len(records))
+}
+
+// runSubjectDelete removes all page views for a data subject
+func runSubjectDelete(args []string) error {
+	q, flags := subjectFlags("subject-delete")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	deleted, err := deleteSubject(*q)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d page views\n", deleted)
+	return writeAudit("delete", "cli", *q, deleted)
+}
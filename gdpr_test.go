@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"            // For matching sentinel errors
+	"net/http"          // For status codes
+	"net/http/httptest" // For admin API requests
+	"os"                // For reading the audit log
+	"path/filepath"     // For the temporary audit log
+	"strings"           // For inspecting the audit log
+	"testing"           // For the test runner
+)
+
+// =============================================================================
+// TEST HELPERS
+// =============================================================================
+
+// subjectTestViews are stored records of two websites; user IDs and IPs are stored as the tracker stores them
+func subjectTestViews() []PageView {
+	return []PageView{
+		{ID: "1", WebsiteID: "site", SessionID: "s1", VisitorID: "v1", UserID: userHash("site", "alice"), IPAddress: "203.0.113.7"},
+		{ID: "2", WebsiteID: "site", SessionID: "s2", VisitorID: "v1", IPAddress: anonymizeIP("198.51.100.9", ipModeHash)},
+		{ID: "3", WebsiteID: "site", SessionID: "s3", VisitorID: "v3", IPAddress: truncateIP("192.0.2.44")},
+		{ID: "4", WebsiteID: "other", SessionID: "s4", VisitorID: "v1", UserID: userHash("other", "alice"), IPAddress: "203.0.113.7"},
+		{ID: "5", WebsiteID: "other", SessionID: "s5", VisitorID: "v5"},
+	}
+}
+
+// useSubjectSecrets sets the user ID and IP hashing secrets for one test
+func useSubjectSecrets(t *testing.T) {
+	t.Setenv("USER_ID_SECRET", "user secret")
+	t.Setenv("IP_HASH_SECRET", "ip secret")
+}
+
+// useTempAuditLog points the audit log at a temporary directory for one test
+func useTempAuditLog(t *testing.T) {
+	previous := auditLogFile
+	t.Cleanup(func() { auditLogFile = previous })
+	auditLogFile = filepath.Join(t.TempDir(), "audit.log")
+}
+
+// =============================================================================
+// SUBJECT MATCHING TESTS
+// =============================================================================
+
+func TestSubjectQueryMatches(t *testing.T) {
+	useSubjectSecrets(t)
+	views := subjectTestViews()
+
+	tests := []struct {
+		name  string
+		query SubjectQuery
+		want  string
+	}{
+		{name: "session ID", query: SubjectQuery{SessionID: "s2"}, want: "2"},
+		{name: "visitor ID across websites", query: SubjectQuery{VisitorID: "v1"}, want: "1,2,4"},
+		{name: "website scope", query: SubjectQuery{VisitorID: "v1", WebsiteID: "other"}, want: "4"},
+		{name: "scope excludes other identifiers too", query: SubjectQuery{SessionID: "s1", WebsiteID: "other"}, want: ""},
+		// The user ID is compared through each record's website-specific HMAC
+		{name: "user ID", query: SubjectQuery{UserID: "alice"}, want: "1,4"},
+		{name: "user ID on one website", query: SubjectQuery{UserID: "alice", WebsiteID: "site"}, want: "1"},
+		{name: "stored hash is not a user ID", query: SubjectQuery{UserID: userHash("site", "alice")}, want: ""},
+		{name: "full IP", query: SubjectQuery{IP: "203.0.113.7"}, want: "1,4"},
+		{name: "hashed IP", query: SubjectQuery{IP: "198.51.100.9"}, want: "2"},
+		// A truncated address belongs to a whole network, not to one person
+		{name: "truncated IP is not matched", query: SubjectQuery{IP: "192.0.2.44"}, want: ""},
+		{name: "any identifier matches", query: SubjectQuery{SessionID: "s5", IP: "198.51.100.9"}, want: "2,5"},
+		{name: "unknown", query: SubjectQuery{SessionID: "nobody"}, want: ""},
+	}
+	for _, tt := range tests {
+		var kept []PageView
+		for _, pv := range views {
+			if tt.query.matches(pv) {
+				kept = append(kept, pv)
+			}
+		}
+		if got := keptIDs(kept); got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubjectQueryWithoutSecrets(t *testing.T) {
+	useSubjectSecrets(t)
+	views := subjectTestViews()
+	// Without the secrets, user IDs and hashed IPs cannot be recomputed, and an empty hash must not match
+	t.Setenv("USER_ID_SECRET", "")
+	t.Setenv("IP_HASH_SECRET", "")
+	for _, q := range []SubjectQuery{{UserID: "alice"}, {IP: "198.51.100.9"}} {
+		for _, pv := range views {
+			if q.matches(pv) {
+				t.Errorf("%+v matched record %s without secrets", q, pv.ID)
+			}
+		}
+	}
+	if !(SubjectQuery{IP: "203.0.113.7"}).matches(views[0]) {
+		t.Error("full IP not matched without secrets")
+	}
+}
+
+// =============================================================================
+// EXPORT AND DELETION TESTS
+// =============================================================================
+
+func TestExportSubject(t *testing.T) {
+	useSubjectSecrets(t)
+	useTestSite(t, []Website{{ID: "site"}, {ID: "other"}}, subjectTestViews())
+
+	records, err := exportSubject(SubjectQuery{UserID: "alice"})
+	if err != nil || keptIDs(records) != "1,4" {
+		t.Errorf("exportSubject(alice) = %q, %v; want records 1,4", keptIDs(records), err)
+	}
+	// Nothing found is an empty list, not null
+	if records, err := exportSubject(SubjectQuery{SessionID: "nobody"}); err != nil || records == nil || len(records) != 0 {
+		t.Errorf("exportSubject(nobody) = %#v, %v; want an empty list", records, err)
+	}
+	if _, err := exportSubject(SubjectQuery{WebsiteID: "site"}); !errors.Is(err, errEmptySubjectQuery) {
+		t.Errorf("exportSubject without identifiers: %v, want errEmptySubjectQuery", err)
+	}
+}
+
+func TestDeleteSubject(t *testing.T) {
+	useSubjectSecrets(t)
+	useTestSite(t, []Website{{ID: "site"}, {ID: "other"}}, subjectTestViews())
+	useTempSketches(t)
+
+	deleted, err := deleteSubject(SubjectQuery{VisitorID: "v1", WebsiteID: "site"})
+	if err != nil || deleted != 2 {
+		t.Fatalf("deleteSubject = %d, %v; want 2", deleted, err)
+	}
+	var stored []PageView
+	if err := readJSONFile(pageViewsFile, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if got := keptIDs(stored); got != "3,4,5" {
+		t.Errorf("kept records %s, want 3,4,5", got)
+	}
+
+	// Deleting again finds nothing; an empty query deletes nothing
+	if deleted, err := deleteSubject(SubjectQuery{VisitorID: "v1", WebsiteID: "site"}); err != nil || deleted != 0 {
+		t.Errorf("second deleteSubject = %d, %v; want 0", deleted, err)
+	}
+	if _, err := deleteSubject(SubjectQuery{}); !errors.Is(err, errEmptySubjectQuery) {
+		t.Errorf("deleteSubject without identifiers: %v, want errEmptySubjectQuery", err)
+	}
+}
+
+// =============================================================================
+// AUDIT LOG TESTS
+// =============================================================================
+
+func TestWriteAudit(t *testing.T) {
+	useSubjectSecrets(t)
+	useTempAuditLog(t)
+
+	q := SubjectQuery{SessionID: "session-abc", VisitorID: "visitor-def", UserID: "alice@example.com", IP: "203.0.113.7", WebsiteID: "site"}
+	if err := writeAudit("delete", "api", q, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAudit("export", "cli", SubjectQuery{SessionID: "session-abc"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := string(data)
+
+	// The log must not keep the identifiers it records the erasure of
+	for _, erased := range []string{"session-abc", "visitor-def", "alice", "203.0.113.7"} {
+		if strings.Contains(entries, erased) {
+			t.Errorf("audit log contains %q:\n%s", erased, entries)
+		}
+	}
+	for _, kept := range []string{auditHash("session-abc"), auditHash("visitor-def"), userHash("site", "alice@example.com"), "203.0.113.0", `"website_id":"site"`, `"records":3`} {
+		if !strings.Contains(entries, kept) {
+			t.Errorf("audit log does not contain %q:\n%s", kept, entries)
+		}
+	}
+	if lines := strings.Count(entries, "\n"); lines != 2 {
+		t.Errorf("audit log has %d lines, want one per entry", lines)
+	}
+	// The same ID always hashes the same way, so an operator can look it up
+	if auditHash("session-abc") != auditHash("session-abc") || auditHash("session-abc") == auditHash("session-abd") || auditHash("") != "" {
+		t.Error("auditHash is not a stable hash of the ID")
+	}
+}
+
+func TestDataSubjectHandler(t *testing.T) {
+	useSubjectSecrets(t)
+	useTestSite(t, []Website{{ID: "site"}, {ID: "other"}}, subjectTestViews())
+	useTempSketches(t)
+	useTempAuditLog(t)
+
+	request := func(method, query, authorization string) int {
+		r := httptest.NewRequest(method, "/admin/subject?"+query, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		dataSubjectHandler(w, r)
+		return w.Code
+	}
+
+	t.Setenv("ADMIN_TOKEN", "")
+	if code := request("GET", "session_id=s1", "Bearer anything"); code != http.StatusForbidden {
+		t.Errorf("without ADMIN_TOKEN: status %d, want 403", code)
+	}
+	t.Setenv("ADMIN_TOKEN", "secret-token")
+	tests := []struct {
+		method, query, authorization string
+		want                         int
+	}{
+		{method: "GET", query: "session_id=s1", authorization: "", want: http.StatusUnauthorized},
+		{method: "GET", query: "session_id=s1", authorization: "secret-token", want: http.StatusUnauthorized}, // No scheme
+		{method: "GET", query: "session_id=s1", authorization: "Bearer wrong", want: http.StatusUnauthorized},
+		{method: "GET", query: "website_id=site", authorization: "Bearer secret-token", want: http.StatusBadRequest},
+		{method: "GET", query: "session_id=s1", authorization: "bearer secret-token", want: http.StatusOK},
+		{method: "DELETE", query: "session_id=s1", authorization: "Bearer secret-token", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := request(tt.method, tt.query, tt.authorization); code != tt.want {
+			t.Errorf("%s ?%s with %q: status %d, want %d", tt.method, tt.query, tt.authorization, code, tt.want)
+		}
+	}
+
+	// The export and the deletion were audited; the rejected requests were not
+	data, _ := os.ReadFile(auditLogFile)
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("audit log has %d entries, want 2:\n%s", lines, data)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"           // For locating the metadata marker
+	"encoding/binary" // For decoding big-endian integers
+	"errors"          // For sentinel errors
+	"fmt"             // For error formatting
+	"math"            // For decoding floating point values
+	"net"             // For parsing IP addresses
+	"os"              // For reading the database file
+)
+
+// =============================================================================
+// GEOIP ENRICHMENT
+// =============================================================================
+
+// GeoLocation is the result of a GeoIP lookup
+type GeoLocation struct {
+	Country string // ISO 3166-1 country code (e.g., "DE")
+	Region  string // First-level subdivision name (e.g., "Berlin")
+	City    string // City name (e.g., "Berlin")
+}
+
+// geoDB is the optional GeoIP database, loaded at startup when GEOIP_DB is set
+var geoDB *mmdbReader
+
+// mmdbMetadataMarker precedes the metadata section at the end of every MaxMind DB file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// errMMDBFormat is returned when the database file is not a valid MaxMind DB
+var errMMDBFormat = errors.New("invalid MaxMind DB file")
+
+// mmdbReader is a minimal reader for the MaxMind DB (.mmdb) format used by GeoLite2, GeoIP2 and DB-IP
+// The whole file is held in memory so lookups never touch the disk or the network
+type mmdbReader struct {
+	buf        []byte // Entire database file
+	nodeCount  uint   // Number of nodes in the search tree
+	recordSize uint   // Bits per search tree record (24, 28 or 32)
+	ipVersion  uint   // 4 or 6
+	dataStart  uint   // Offset of the data section within buf
+	ipv4Start  uint   // Node where IPv4 lookups begin in an IPv6 tree
+}
+
+// loadGeoIP opens the MaxMind DB file configured by the GEOIP_DB environment variable
+// It does nothing if the variable is unset
+func loadGeoIP() error {
+	path := os.Getenv("GEOIP_DB")
+	if path == "" {
+		return nil
+	}
+	reader, err := openMMDB(path)
+	if err != nil {
+		return err
+	}
+	geoDB = reader
+	return nil
+}
+
+// lookupGeo resolves an IP address to a location using the loaded GeoIP database
+// It returns an empty location if no database is loaded or the address is not found
+func lookupGeo(ip string) GeoLocation {
+	if geoDB == nil {
+		return GeoLocation{}
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return GeoLocation{}
+	}
+	record, err := geoDB.lookup(parsed)
+	if err != nil || record == nil {
+		return GeoLocation{}
+	}
+
+	var location GeoLocation
+	if country, ok := record["country"].(map[string]interface{}); ok {
+		location.Country, _ = country["iso_code"].(string)
+	}
+	if subdivisions, ok := record["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+		if region, ok := subdivisions[0].(map[string]interface{}); ok {
+			location.Region = englishName(region)
+		}
+	}
+	if city, ok := record["city"].(map[string]interface{}); ok {
+		location.City = englishName(city)
+	}
+	return location
+}
+
+// englishName returns the English entry from a GeoIP "names" map
+func englishName(entry map[string]interface{}) string {
+	names, ok := entry["names"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := names["en"].(string)
+	return name
+}
+
+// openMMDB reads a MaxMind DB file and parses its metadata
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+
+	markerAt := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if markerAt < 0 {
+		return nil, errMMDBFormat
+	}
+	metaStart := uint(markerAt + len(mmdbMetadataMarker))
+
+	// Metadata uses the same encoding as the data section, with offsets relative to its start
+	meta := &mmdbReader{buf: buf, dataStart: metaStart}
+	value, _, err := meta.decode(metaStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GeoIP metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errMMDBFormat
+	}
+
+	reader := &mmdbReader{
+		buf:        buf,
+		nodeCount:  uint(toUint(metadata["node_count"])),
+		recordSize: uint(toUint(metadata["record_size"])),
+		ipVersion:  uint(toUint(metadata["ip_version"])),
+	}
+	if reader.recordSize != 24 && reader.recordSize != 28 && reader.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported GeoIP record size %d", reader.recordSize)
+	}
+
+	// The data section follows the search tree and a 16-byte null separator
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	reader.dataStart = treeSize + 16
+	if reader.dataStart > uint(markerAt) {
+		return nil, errMMDBFormat
+	}
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree; find that node once
+	if reader.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node = reader.readNode(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+	return reader, nil
+}
+
+// lookup walks the search tree for ip and decodes the record it points to
+// It returns nil if the address is not in the database
+func (r *mmdbReader) lookup(ip net.IP) (map[string]interface{}, error) {
+	bits := ip.To4()
+	node := uint(0)
+	switch {
+	case bits != nil && r.ipVersion == 6:
+		node = r.ipv4Start
+	case bits == nil && r.ipVersion == 4:
+		// IPv6 addresses cannot be found in an IPv4-only database
+		return nil, nil
+	case bits == nil:
+		bits = ip.To16()
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+		node = r.readNode(node, uint(bit))
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errMMDBFormat
+	}
+
+	// Record values past the node count are pointers into the data section
+	offset := r.dataStart + node - r.nodeCount - 16
+	value, _, err := r.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of a search tree node
+func (r *mmdbReader) readNode(node, bit uint) uint {
+	size := r.recordSize / 4 // bytes per node
+	b := r.buf[node*size : node*size+size]
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		// The middle byte holds the high nibble of each record
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// MaxMind DB data section types
+const (
+	mmdbExtended = 0
+	mmdbPointer  = 1
+	mmdbString   = 2
+	mmdbDouble   = 3
+	mmdbBytes    = 4
+	mmdbUint16   = 5
+	mmdbUint32   = 6
+	mmdbMap      = 7
+	mmdbInt32    = 8
+	mmdbUint64   = 9
+	mmdbUint128  = 10
+	mmdbArray    = 11
+	mmdbBool     = 14
+	mmdbFloat    = 15
+)
+
+// mmdbMaxDepth limits how deeply maps, arrays and pointers may nest in the data section
+// Real records nest a few levels; a corrupt file with a pointer cycle would otherwise recurse forever
+const mmdbMaxDepth = 32
+
+// decode reads one value from the data section at offset
+// It returns the value and the offset immediately after it
+func (r *mmdbReader) decode(offset uint) (interface{}, uint, error) {
+	return r.decodeValue(offset, 0)
+}
+
+// decodeValue decodes the value at offset, nested depth levels below the value being read
+func (r *mmdbReader) decodeValue(offset, depth uint) (interface{}, uint, error) {
+	if offset >= uint(len(r.buf)) || depth > mmdbMaxDepth {
+		return nil, 0, errMMDBFormat
+	}
+	ctrl := r.buf[offset]
+	offset++
+
+	dataType := uint(ctrl >> 5)
+	if dataType == mmdbPointer {
+		pointer, next, err := r.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// The format does not allow a pointer to point to another pointer
+		target := r.dataStart + pointer
+		if target < uint(len(r.buf)) && uint(r.buf[target]>>5) == mmdbPointer {
+			return nil, 0, errMMDBFormat
+		}
+		value, _, err := r.decodeValue(target, depth+1)
+		return value, next, err
+	}
+	if dataType == mmdbExtended {
+		if offset >= uint(len(r.buf)) {
+			return nil, 0, errMMDBFormat
+		}
+		dataType = 7 + uint(r.buf[offset])
+		offset++
+	}
+
+	size, offset, err := r.decodeSize(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch dataType {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := r.decodeValue(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, after, err := r.decodeValue(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBFormat
+			}
+			m[keyString] = value
+			offset = after
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := r.decodeValue(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	// All remaining types store their payload inline
+	if offset+size > uint(len(r.buf)) {
+		return nil, 0, errMMDBFormat
+	}
+	payload := r.buf[offset : offset+size]
+	next := offset + size
+
+	switch dataType {
+	case mmdbString:
+		return string(payload), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBFormat
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBFormat
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		// uint128 values are truncated to 64 bits; GeoIP records never use them
+		var n uint64
+		for _, b := range payload {
+			n = n<<8 | uint64(b)
+		}
+		return n, next, nil
+	case mmdbInt32:
+		var n uint32
+		for _, b := range payload {
+			n = n<<8 | uint32(b)
+		}
+		return int64(int32(n)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported MaxMind DB data type %d", dataType)
+	}
+}
+
+// decodeSize reads the payload size encoded in a control byte and any size extension bytes
+func (r *mmdbReader) decodeSize(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+	extra := size - 28 // 1, 2 or 3 extension bytes
+	if offset+extra > uint(len(r.buf)) {
+		return 0, 0, errMMDBFormat
+	}
+	var n uint
+	for _, b := range r.buf[offset : offset+extra] {
+		n = n<<8 | uint(b)
+	}
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return size, offset + extra, nil
+}
+
+// decodePointer reads a data section pointer; the size bits select a 1-4 byte encoding
+func (r *mmdbReader) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	sizeBits := uint(ctrl>>3) & 0x3
+	length := sizeBits + 1
+	if offset+length > uint(len(r.buf)) {
+		return 0, 0, errMMDBFormat
+	}
+	var n uint
+	for _, b := range r.buf[offset : offset+length] {
+		n = n<<8 | uint(b)
+	}
+	vvv := uint(ctrl & 0x7)
+	switch sizeBits {
+	case 0:
+		n = vvv<<8 | n
+	case 1:
+		n = (vvv<<16 | n) + 2048
+	case 2:
+		n = (vvv<<24 | n) + 526336
+	}
+	return n, offset + length, nil
+}
+
+// toUint converts a decoded metadata number to uint64
+func toUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
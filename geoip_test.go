@@ -0,0 +1,465 @@
+package main
+
+import (
+	"encoding/binary" // For encoding fixture numbers
+	"errors"          // For matching sentinel errors
+	"math"            // For encoding fixture floats
+	"net"             // For parsing fixture networks
+	"os"              // For writing fixture databases
+	"path/filepath"   // For fixture paths
+	"reflect"         // For comparing decoded values
+	"testing"         // For the test runner
+)
+
+// =============================================================================
+// MMDB FIXTURE WRITER
+// =============================================================================
+
+// The tests build small MaxMind DB files in memory rather than shipping binary fixtures.
+// The writer supports just enough of the format for the reader: maps, arrays, strings,
+// unsigned integers and pointers, in a search tree with 24, 28 or 32-bit records.
+
+// mmdbTestValue is a value encoded into a fixture's data section
+type mmdbTestValue interface{}
+
+// mmdbTestMap keeps its keys in order so fixtures are byte-for-byte reproducible
+type mmdbTestMap []mmdbTestEntry
+
+type mmdbTestEntry struct {
+	Key   string
+	Value mmdbTestValue
+}
+
+// mmdbTestPointer encodes a pointer to an earlier offset in the data section
+type mmdbTestPointer uint
+
+// mmdbTestUint encodes an unsigned integer with the given data type
+type mmdbTestUint struct {
+	Type  int
+	Value uint64
+}
+
+// mmdbControl writes a control byte and size, using the extended type byte for types above 7
+func mmdbControl(dataType, size int) []byte {
+	var out []byte
+	ctrlType := dataType
+	if dataType > 7 {
+		ctrlType = mmdbExtended
+	}
+	switch {
+	case size < 29:
+		out = append(out, byte(ctrlType<<5|size))
+	case size < 285:
+		out = append(out, byte(ctrlType<<5|29))
+	default:
+		out = append(out, byte(ctrlType<<5|30))
+	}
+	if dataType > 7 {
+		out = append(out, byte(dataType-7))
+	}
+	switch {
+	case size >= 285:
+		n := size - 285
+		out = append(out, byte(n>>8), byte(n))
+	case size >= 29:
+		out = append(out, byte(size-29))
+	}
+	return out
+}
+
+// encodeMMDB encodes a value in the MaxMind DB data format
+func encodeMMDB(v mmdbTestValue) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(mmdbControl(mmdbString, len(v)), v...)
+	case mmdbTestUint:
+		var payload []byte
+		for n := v.Value; n > 0; n >>= 8 {
+			payload = append([]byte{byte(n)}, payload...)
+		}
+		return append(mmdbControl(v.Type, len(payload)), payload...)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		return mmdbControl(mmdbBool, size)
+	case float64:
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint64(payload, math.Float64bits(v))
+		return append(mmdbControl(mmdbDouble, 8), payload...)
+	case int32:
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, uint32(v))
+		return append(mmdbControl(mmdbInt32, 4), payload...)
+	case mmdbTestPointer:
+		// Only the 11-bit form is needed for fixtures this small
+		return []byte{byte(mmdbPointer<<5 | int(v>>8)&0x7), byte(v)}
+	case []mmdbTestValue:
+		out := mmdbControl(mmdbArray, len(v))
+		for _, item := range v {
+			out = append(out, encodeMMDB(item)...)
+		}
+		return out
+	case mmdbTestMap:
+		out := mmdbControl(mmdbMap, len(v))
+		for _, entry := range v {
+			out = append(out, encodeMMDB(entry.Key)...)
+			out = append(out, encodeMMDB(entry.Value)...)
+		}
+		return out
+	}
+	panic("unsupported fixture value")
+}
+
+// mmdbTestNode is a search tree node; each side points to a child, a data offset or nothing
+type mmdbTestNode struct {
+	children [2]*mmdbTestNode
+	data     [2]int // Data section offset + 1, or 0 when the side has no record
+	id       int
+}
+
+// mmdbTestNetwork maps a CIDR network to a record in the data section
+type mmdbTestNetwork struct {
+	CIDR   string
+	Record mmdbTestValue
+}
+
+// buildMMDB writes a database with the given IP version and record size to a temporary file
+// IPv4 networks in an IPv6 database are placed under ::/96, as GeoLite2 does
+func buildMMDB(t *testing.T, ipVersion, recordSize int, networks []mmdbTestNetwork) string {
+	t.Helper()
+
+	root := &mmdbTestNode{}
+	var data []byte
+	for _, network := range networks {
+		ip, ipNet, err := net.ParseCIDR(network.CIDR)
+		if err != nil {
+			t.Fatalf("bad fixture network %q: %v", network.CIDR, err)
+		}
+		ones, _ := ipNet.Mask.Size()
+		bits := []byte(ip.To4())
+		switch {
+		case bits == nil:
+			bits = []byte(ip.To16())
+		case ipVersion == 6:
+			// ::a.b.c.d, not the ::ffff:a.b.c.d that net.IP.To16 returns
+			bits = append(make([]byte, 12), bits...)
+			ones += 96
+		}
+
+		offset := len(data)
+		data = append(data, encodeMMDB(network.Record)...)
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				node.data[bit] = offset + 1
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &mmdbTestNode{}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	// Number the nodes depth-first; the root must be node 0
+	var nodes []*mmdbTestNode
+	var number func(*mmdbTestNode)
+	number = func(n *mmdbTestNode) {
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil {
+				number(child)
+			}
+		}
+	}
+	number(root)
+	nodeCount := len(nodes)
+
+	record := func(n *mmdbTestNode, bit int) uint32 {
+		switch {
+		case n.children[bit] != nil:
+			return uint32(n.children[bit].id)
+		case n.data[bit] != 0:
+			return uint32(nodeCount + 16 + n.data[bit] - 1)
+		default:
+			return uint32(nodeCount) // Not found
+		}
+	}
+
+	var file []byte
+	for _, n := range nodes {
+		left, right := record(n, 0), record(n, 1)
+		switch recordSize {
+		case 24:
+			file = append(file, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			file = append(file, byte(left>>16), byte(left>>8), byte(left),
+				byte(left>>24)<<4|byte(right>>24)&0x0F,
+				byte(right>>16), byte(right>>8), byte(right))
+		default:
+			file = binary.BigEndian.AppendUint32(file, left)
+			file = binary.BigEndian.AppendUint32(file, right)
+		}
+	}
+	file = append(file, make([]byte, 16)...)
+	file = append(file, data...)
+	file = append(file, mmdbMetadataMarker...)
+	file = append(file, encodeMMDB(mmdbTestMap{
+		{"binary_format_major_version", mmdbTestUint{mmdbUint16, 2}},
+		{"database_type", "Test-City"},
+		{"ip_version", mmdbTestUint{mmdbUint16, uint64(ipVersion)}},
+		{"node_count", mmdbTestUint{mmdbUint32, uint64(nodeCount)}},
+		{"record_size", mmdbTestUint{mmdbUint16, uint64(recordSize)}},
+	})...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// cityRecord builds a GeoIP2 City-style record
+func cityRecord(country, region, city mmdbTestValue) mmdbTestMap {
+	names := func(name mmdbTestValue) mmdbTestMap {
+		return mmdbTestMap{{"names", mmdbTestMap{{"de", "-"}, {"en", name}}}}
+	}
+	record := mmdbTestMap{{"country", mmdbTestMap{{"iso_code", country}}}}
+	if region != nil {
+		record = append(record, mmdbTestEntry{"subdivisions", []mmdbTestValue{names(region)}})
+	}
+	if city != nil {
+		record = append(record, mmdbTestEntry{"city", names(city)})
+	}
+	return record
+}
+
+// =============================================================================
+// MMDB READER TESTS
+// =============================================================================
+
+func TestMMDBLookup(t *testing.T) {
+	// A 40-character name needs the one-byte size extension
+	longCity := "Llanfairpwllgwyngyllgogerychwyrndrobwll!"
+	networks := []mmdbTestNetwork{
+		{CIDR: "81.2.69.0/24", Record: cityRecord("GB", "England", "London")},
+		{CIDR: "2.0.0.0/8", Record: cityRecord("DE", nil, nil)},
+		{CIDR: "81.2.70.0/25", Record: cityRecord("GB", "Wales", longCity)},
+		// The record is a pointer to the first record ("GB", London) at data offset 0
+		{CIDR: "81.2.71.0/24", Record: mmdbTestPointer(0)},
+	}
+
+	tests := []struct {
+		ip   string
+		want GeoLocation
+	}{
+		{ip: "81.2.69.160", want: GeoLocation{Country: "GB", Region: "England", City: "London"}},
+		{ip: "81.2.69.0", want: GeoLocation{Country: "GB", Region: "England", City: "London"}},
+		{ip: "2.3.4.5", want: GeoLocation{Country: "DE"}},
+		{ip: "81.2.70.1", want: GeoLocation{Country: "GB", Region: "Wales", City: longCity}},
+		{ip: "81.2.70.200", want: GeoLocation{}}, // Outside the /25
+		{ip: "81.2.71.9", want: GeoLocation{Country: "GB", Region: "England", City: "London"}},
+		{ip: "8.8.8.8", want: GeoLocation{}},
+		{ip: "not an ip", want: GeoLocation{}},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			path := buildMMDB(t, ipVersion, recordSize, append(networks,
+				mmdbTestNetwork{CIDR: "2001:db8::/32", Record: cityRecord("FR", nil, "Paris")}))
+			reader, err := openMMDB(path)
+			if err != nil {
+				t.Fatalf("openMMDB (v%d, %d-bit): %v", ipVersion, recordSize, err)
+			}
+
+			previous := geoDB
+			geoDB = reader
+			for _, tt := range tests {
+				if got := lookupGeo(tt.ip); got != tt.want {
+					t.Errorf("v%d %d-bit: lookupGeo(%q) = %+v, want %+v", ipVersion, recordSize, tt.ip, got, tt.want)
+				}
+			}
+
+			// IPv6 networks are only stored in IPv6 databases
+			want := GeoLocation{}
+			if ipVersion == 6 {
+				want = GeoLocation{Country: "FR", City: "Paris"}
+			}
+			if got := lookupGeo("2001:db8::1"); got != want {
+				t.Errorf("v%d %d-bit: lookupGeo(2001:db8::1) = %+v, want %+v", ipVersion, recordSize, got, want)
+			}
+			geoDB = previous
+		}
+	}
+}
+
+func TestLoadGeoIP(t *testing.T) {
+	previous := geoDB
+	defer func() { geoDB = previous }()
+
+	t.Setenv("GEOIP_DB", "")
+	geoDB = nil
+	if err := loadGeoIP(); err != nil || geoDB != nil {
+		t.Fatalf("loadGeoIP without GEOIP_DB = %v (db loaded: %v), want no error and no database", err, geoDB != nil)
+	}
+	if got := lookupGeo("81.2.69.160"); got != (GeoLocation{}) {
+		t.Errorf("lookupGeo without a database = %+v, want empty", got)
+	}
+
+	t.Setenv("GEOIP_DB", buildMMDB(t, 4, 24, []mmdbTestNetwork{{CIDR: "81.2.69.0/24", Record: cityRecord("GB", nil, nil)}}))
+	if err := loadGeoIP(); err != nil {
+		t.Fatalf("loadGeoIP: %v", err)
+	}
+	if got := lookupGeo("81.2.69.160"); got.Country != "GB" {
+		t.Errorf("lookupGeo after loadGeoIP = %+v, want country GB", got)
+	}
+}
+
+func TestOpenMMDBErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := openMMDB(filepath.Join(dir, "missing.mmdb")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got %v, want os.ErrNotExist", err)
+	}
+
+	garbage := filepath.Join(dir, "garbage.mmdb")
+	os.WriteFile(garbage, []byte("this is not a database"), 0644)
+	if _, err := openMMDB(garbage); !errors.Is(err, errMMDBFormat) {
+		t.Errorf("no metadata marker: got %v, want errMMDBFormat", err)
+	}
+
+	// Valid metadata with a record size the reader does not support
+	badSize := filepath.Join(dir, "bad-size.mmdb")
+	meta := append(append([]byte{}, mmdbMetadataMarker...), encodeMMDB(mmdbTestMap{
+		{"ip_version", mmdbTestUint{mmdbUint16, 4}},
+		{"node_count", mmdbTestUint{mmdbUint32, 1}},
+		{"record_size", mmdbTestUint{mmdbUint16, 20}},
+	})...)
+	os.WriteFile(badSize, meta, 0644)
+	if _, err := openMMDB(badSize); err == nil {
+		t.Error("record size 20: got no error")
+	}
+
+	// A node count larger than the file leaves no room for the search tree
+	truncated := filepath.Join(dir, "truncated.mmdb")
+	meta = append(append([]byte{}, mmdbMetadataMarker...), encodeMMDB(mmdbTestMap{
+		{"ip_version", mmdbTestUint{mmdbUint16, 4}},
+		{"node_count", mmdbTestUint{mmdbUint32, 1000}},
+		{"record_size", mmdbTestUint{mmdbUint16, 24}},
+	})...)
+	os.WriteFile(truncated, meta, 0644)
+	if _, err := openMMDB(truncated); !errors.Is(err, errMMDBFormat) {
+		t.Errorf("truncated tree: got %v, want errMMDBFormat", err)
+	}
+}
+
+func TestMMDBDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value mmdbTestValue
+		want  interface{}
+	}{
+		{name: "string", value: "Berlin", want: "Berlin"},
+		{name: "empty string", value: "", want: ""},
+		{name: "uint16", value: mmdbTestUint{mmdbUint16, 443}, want: uint64(443)},
+		{name: "uint32", value: mmdbTestUint{mmdbUint32, 1 << 30}, want: uint64(1 << 30)},
+		{name: "uint64", value: mmdbTestUint{mmdbUint64, 1 << 40}, want: uint64(1 << 40)},
+		{name: "zero", value: mmdbTestUint{mmdbUint32, 0}, want: uint64(0)},
+		{name: "int32", value: int32(-5), want: int64(-5)},
+		{name: "double", value: 52.52, want: 52.52},
+		{name: "true", value: true, want: true},
+		{name: "false", value: false, want: false},
+		{name: "array", value: []mmdbTestValue{"a", mmdbTestUint{mmdbUint16, 1}}, want: []interface{}{"a", uint64(1)}},
+		{name: "nested map", value: mmdbTestMap{{"names", mmdbTestMap{{"en", "Berlin"}}}},
+			want: map[string]interface{}{"names": map[string]interface{}{"en": "Berlin"}}},
+		{name: "long string", value: string(make([]byte, 300)), want: string(make([]byte, 300))},
+	}
+	for _, tt := range tests {
+		encoded := encodeMMDB(tt.value)
+		r := &mmdbReader{buf: encoded}
+		got, next, err := r.decode(0)
+		if err != nil {
+			t.Errorf("%s: decode error %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: decoded %#v, want %#v", tt.name, got, tt.want)
+		}
+		if next != uint(len(encoded)) {
+			t.Errorf("%s: next offset %d, want %d", tt.name, next, len(encoded))
+		}
+	}
+
+	// Truncated payloads must fail instead of reading past the buffer
+	for _, value := range []mmdbTestValue{"Berlin", 52.52, mmdbTestMap{{"en", "Berlin"}}} {
+		encoded := encodeMMDB(value)
+		r := &mmdbReader{buf: encoded[:len(encoded)-1]}
+		if _, _, err := r.decode(0); err == nil {
+			t.Errorf("decode of truncated %#v: got no error", value)
+		}
+	}
+}
+
+// nestedArrays wraps a string in depth single-element arrays
+func nestedArrays(depth int) mmdbTestValue {
+	var v mmdbTestValue = "deep"
+	for i := 0; i < depth; i++ {
+		v = []mmdbTestValue{v}
+	}
+	return v
+}
+
+// nestedValue is the decoded form of nestedArrays
+func nestedValue(depth int) interface{} {
+	var v interface{} = "deep"
+	for i := 0; i < depth; i++ {
+		v = []interface{}{v}
+	}
+	return v
+}
+
+func TestMMDBDecodePointers(t *testing.T) {
+	berlin := encodeMMDB("Berlin")
+	after := uint(len(berlin))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		offset  uint
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "pointer to a string", data: append(encodeMMDB("Berlin"), encodeMMDB(mmdbTestMap{{"city", mmdbTestPointer(0)}})...), offset: after,
+			want: map[string]interface{}{"city": "Berlin"}},
+		{name: "pointer to a pointer", data: append(append(encodeMMDB("Berlin"), encodeMMDB(mmdbTestPointer(0))...), encodeMMDB(mmdbTestPointer(after))...),
+			offset: after + 2, wantErr: true},
+		{name: "pointer to itself", data: encodeMMDB(mmdbTestPointer(0)), wantErr: true},
+		// A map holding a pointer back to itself is not a pointer to a pointer, but nests without end
+		{name: "cycle through a map", data: encodeMMDB(mmdbTestMap{{"self", mmdbTestPointer(0)}}), wantErr: true},
+		{name: "pointer past the end", data: encodeMMDB(mmdbTestPointer(100)), wantErr: true},
+		{name: "nesting within the limit", data: encodeMMDB(nestedArrays(mmdbMaxDepth)), want: nestedValue(mmdbMaxDepth)},
+		{name: "nesting beyond the limit", data: encodeMMDB(nestedArrays(mmdbMaxDepth + 1)), wantErr: true},
+	}
+	for _, tt := range tests {
+		r := &mmdbReader{buf: tt.data}
+		got, next, err := r.decode(tt.offset)
+		if tt.wantErr {
+			if !errors.Is(err, errMMDBFormat) {
+				t.Errorf("%s: decode = %#v, %v; want errMMDBFormat", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: decode = %#v, %v; want %#v", tt.name, got, err, tt.want)
+		}
+		// The value continues after the pointer, not after what it points to
+		if next != uint(len(tt.data)) {
+			t.Errorf("%s: next offset %d, want %d", tt.name, next, len(tt.data))
+		}
+	}
+}
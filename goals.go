@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json" // For compiling patterns when goals are decoded
+)
+
+// =============================================================================
+// CONVERSION GOALS
+// =============================================================================
+
+// Goal is a conversion configured on a website in websites.json
+// Set Page for a page-visit goal or Event (optionally with Props) for a custom-event goal, e.g.:
+//
+//	{"name": "Newsletter", "page": "/newsletter/thanks"}
+//	{"name": "Pro signup", "event": "signup", "props": {"plan": "pro"}}
+type Goal struct {
+	Name  string            `json:"name"`            // Name shown in reports and used by goal filters
+	Page  string            `json:"page,omitempty"`  // Page path to match; "*" matches any characters (e.g. /docs/*)
+	Event string            `json:"event,omitempty"` // Custom event name to match
+	Props map[string]string `json:"props,omitempty"` // Event properties that must all match; values may use "*"
+
+	patterns *goalPatterns // Compiled Page and Props, set when the goal is decoded
+}
+
+// goalPatterns holds a goal's compiled wildcards
+type goalPatterns struct {
+	page  wildcard
+	props map[string]wildcard
+}
+
+// UnmarshalJSON decodes a goal (or funnel step) and compiles its patterns once,
+// so matching it against every record does not recompile them
+func (g *Goal) UnmarshalJSON(b []byte) error {
+	type plainGoal Goal // Same fields without this method, to avoid recursion
+	if err := json.Unmarshal(b, (*plainGoal)(g)); err != nil {
+		return err
+	}
+	g.patterns = g.compile()
+	return nil
+}
+
+// compile builds the goal's wildcards
+func (g Goal) compile() *goalPatterns {
+	p := &goalPatterns{page: compileWildcard(g.Page), props: make(map[string]wildcard, len(g.Props))}
+	for name, pattern := range g.Props {
+		p.props[name] = compileWildcard(pattern)
+	}
+	return p
+}
+
+// compiled returns the goal's patterns; goals built in code rather than decoded are compiled on each call
+func (g Goal) compiled() *goalPatterns {
+	if g.patterns != nil {
+		return g.patterns
+	}
+	return g.compile()
+}
+
+// GoalRow reports the conversions for a single goal
+type GoalRow struct {
+	Name           string  `json:"name"`             // Goal name
+	Completions    int     `json:"completions"`      // Page views or events that completed the goal
+	Sessions       int     `json:"sessions"`         // Unique sessions that completed the goal
+	ConversionRate float64 `json:"conversion_rate"`  // Percentage of all sessions that completed the goal
+	Change         *Change `json:"change,omitempty"` // Change in completions (only with ?compare)
+}
+
+// matches reports whether a record completes the goal
+// Page goals match page views only, so a 404 or custom event on the same URL does not count
+func (g Goal) matches(pv PageView) bool {
+	p := g.compiled()
+	if g.Event != "" {
+		if pv.Event != g.Event {
+			return false
+		}
+		for name, pattern := range p.props {
+			if !pattern.match(pv.Props[name]) {
+				return false
+			}
+		}
+		return true
+	}
+	if g.Page != "" {
+		return pv.Event == "" && p.page.match(pagePath(pv.PageURL))
+	}
+	return false // A goal without a page or event can never be completed
+}
+
+// completedGoals lists the names of the website's goals that a record completes
+func completedGoals(pv PageView, website Website) []string {
+	var names []string
+	for _, goal := range website.Goals {
+		if goal.matches(pv) {
+			names = append(names, goal.Name)
+		}
+	}
+	return names
+}
+
+// goalRecords selects the records goals are counted over: every record of the sessions the filters
+// selected, so a signup on another page still counts for a session that matched page==/pricing,
+// plus the anonymous records that matched on their own values
+func goalRecords(all, matched []PageView) []PageView {
+	records := sessionRecords(all, matched)
+	if len(matched) == len(all) {
+		return records // Unfiltered: anonymous records are already included
+	}
+	for _, pv := range matched {
+		if pv.SessionID == "" {
+			records = append(records, pv)
+		}
+	}
+	return records
+}
+
+// goalReport counts completions and converting sessions for each goal, in configuration order
+// The conversion rate is relative to totalSessions, the number of sessions in the report.
+// Completions without a session ID (anonymous hits) count as completions but not as sessions.
+func goalReport(records []PageView, goals []Goal, totalSessions int) []GoalRow {
+	rows := []GoalRow{}
+	for _, goal := range goals {
+		row := GoalRow{Name: goal.Name}
+		sessions := make(map[string]bool)
+		for _, pv := range records {
+			if !goal.matches(pv) {
+				continue
+			}
+			row.Completions++
+			if pv.SessionID != "" {
+				sessions[pv.SessionID] = true
+			}
+		}
+		row.Sessions = len(sessions)
+		if totalSessions > 0 {
+			row.ConversionRate = float64(row.Sessions) * 100 / float64(totalSessions)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json" // For decoding goals as websites.json does
+	"testing"       // For the test runner
+)
+
+// =============================================================================
+// GOAL TESTS
+// =============================================================================
+
+func TestGoalMatches(t *testing.T) {
+	pricing := PageView{PageURL: "https://example.com/pricing?plan=pro"}
+	missing := PageView{PageURL: "https://example.com/pricing", Event: eventNotFound}
+	signup := PageView{PageURL: "https://example.com/signup", Event: "signup", Props: map[string]string{"plan": "pro-annual", "source": "ad"}}
+
+	tests := []struct {
+		name string
+		goal Goal
+		pv   PageView
+		want bool
+	}{
+		{name: "page ignores the query string", goal: Goal{Page: "/pricing"}, pv: pricing, want: true},
+		{name: "page wildcard", goal: Goal{Page: "/pri*"}, pv: pricing, want: true},
+		{name: "different page", goal: Goal{Page: "/signup"}, pv: pricing, want: false},
+		{name: "a 404 on the goal page does not count", goal: Goal{Page: "/pricing"}, pv: missing, want: false},
+		{name: "an event on the goal page does not count", goal: Goal{Page: "/signup"}, pv: signup, want: false},
+		{name: "event", goal: Goal{Event: "signup"}, pv: signup, want: true},
+		{name: "different event", goal: Goal{Event: "purchase"}, pv: signup, want: false},
+		{name: "event goals ignore page views", goal: Goal{Event: "signup"}, pv: pricing, want: false},
+		{name: "every property must match", goal: Goal{Event: "signup", Props: map[string]string{"plan": "pro-*", "source": "ad"}}, pv: signup, want: true},
+		{name: "one property differs", goal: Goal{Event: "signup", Props: map[string]string{"plan": "pro-*", "source": "email"}}, pv: signup, want: false},
+		{name: "missing property", goal: Goal{Event: "signup", Props: map[string]string{"coupon": "*x"}}, pv: signup, want: false},
+		{name: "goal without page or event", goal: Goal{Name: "empty"}, pv: pricing, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.goal.matches(tt.pv); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGoalUnmarshalJSON(t *testing.T) {
+	var website Website
+	config := `{"id": "site", "goals": [{"name": "Docs", "page": "/docs/*"}, {"name": "Pro", "event": "signup", "props": {"plan": "pro-*"}}],
+		"funnels": [{"name": "Signup", "steps": [{"page": "/pricing"}, {"event": "signup"}]}]}`
+	if err := json.Unmarshal([]byte(config), &website); err != nil {
+		t.Fatal(err)
+	}
+
+	// Goals and funnel steps are compiled when decoded, not on every match
+	for _, goal := range append(website.Goals, website.Funnels[0].Steps...) {
+		if goal.patterns == nil {
+			t.Errorf("goal %+v was not compiled", goal)
+		}
+	}
+	docs, pro := website.Goals[0], website.Goals[1]
+	if !docs.matches(PageView{PageURL: "https://example.com/docs/a/b"}) || docs.matches(PageView{PageURL: "https://example.com/doc"}) {
+		t.Error("decoded page goal matches the wrong pages")
+	}
+	if !pro.matches(PageView{Event: "signup", Props: map[string]string{"plan": "pro-annual"}}) ||
+		pro.matches(PageView{Event: "signup", Props: map[string]string{"plan": "free"}}) {
+		t.Error("decoded event goal matches the wrong properties")
+	}
+
+	// Compiled patterns are never written back to websites.json
+	data, _ := json.Marshal(website.Goals[0])
+	if string(data) != `{"name":"Docs","page":"/docs/*"}` {
+		t.Errorf("encoded goal = %s", data)
+	}
+}
+
+func TestGoalReport(t *testing.T) {
+	goals := []Goal{
+		{Name: "Signup", Event: "signup"},
+		{Name: "Docs", Page: "/docs/*"},
+		{Name: "Never", Page: "/nowhere"},
+	}
+	records := []PageView{
+		{SessionID: "s1", PageURL: "https://example.com/docs/a"},
+		{SessionID: "s1", PageURL: "https://example.com/docs/b"},
+		{SessionID: "s1", PageURL: "https://example.com/", Event: "signup"},
+		{SessionID: "s2", PageURL: "https://example.com/docs/a"},
+		{SessionID: "s3", PageURL: "https://example.com/"},
+		{SessionID: "s4", PageURL: "https://example.com/"},
+		{PageURL: "https://example.com/", Event: "signup"}, // Anonymous: a completion without a session
+	}
+
+	rows := goalReport(records, goals, 4)
+	want := []GoalRow{
+		{Name: "Signup", Completions: 2, Sessions: 1, ConversionRate: 25},
+		{Name: "Docs", Completions: 3, Sessions: 2, ConversionRate: 50},
+		{Name: "Never", Completions: 0, Sessions: 0, ConversionRate: 0},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("goalReport returned %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		if row.Name != want[i].Name || row.Completions != want[i].Completions ||
+			row.Sessions != want[i].Sessions || row.ConversionRate != want[i].ConversionRate {
+			t.Errorf("row %d = %+v, want %+v", i, row, want[i])
+		}
+	}
+
+	// No sessions in the period: no division by zero, and never a nil list in the JSON
+	if rows := goalReport(nil, goals, 0); len(rows) != 3 || rows[0].ConversionRate != 0 {
+		t.Errorf("goalReport without records = %+v", rows)
+	}
+	if rows := goalReport(records, nil, 4); rows == nil || len(rows) != 0 {
+		t.Errorf("goalReport without goals = %#v, want an empty list", rows)
+	}
+}
+
+func TestGoalReportFiltered(t *testing.T) {
+	website := Website{ID: "site", Domain: "example.com", Goals: []Goal{{Name: "Signup", Event: "signup"}}}
+	// s1 arrives from Google, views /pricing and signs up on /signup; s2 browses the blog
+	all := []PageView{
+		{SessionID: "s1", PageURL: "https://example.com/pricing", Referrer: "https://www.google.com/"},
+		{SessionID: "s1", PageURL: "https://example.com/signup"},
+		{SessionID: "s1", PageURL: "https://example.com/signup", Event: "signup"},
+		{SessionID: "s2", PageURL: "https://example.com/blog/"},
+		{PageURL: "https://example.com/pricing", Event: "signup"}, // Anonymous signup on /pricing
+		{PageURL: "https://example.com/blog/", Event: "signup"},   // Anonymous signup elsewhere
+	}
+
+	tests := []struct {
+		filter      string
+		completions int
+		sessions    int
+	}{
+		{filter: "source==Google", completions: 1, sessions: 1},
+		{filter: "page==/pricing", completions: 2, sessions: 1}, // s1's signup and the anonymous one on /pricing
+		{filter: "page==/blog/", completions: 1, sessions: 0},
+		{filter: "event==signup", completions: 3, sessions: 1},
+	}
+	for _, tt := range tests {
+		filters, err := parseFilters([]string{tt.filter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched := applyFilters(all, filters, website)
+		rows := goalReport(goalRecords(all, matched), website.Goals, 1)
+		if rows[0].Completions != tt.completions || rows[0].Sessions != tt.sessions {
+			t.Errorf("%s: %d completions in %d sessions, want %d in %d",
+				tt.filter, rows[0].Completions, rows[0].Sessions, tt.completions, tt.sessions)
+		}
+	}
+
+	// Unfiltered, every record counts once
+	if rows := goalReport(goalRecords(all, all), website.Goals, 2); rows[0].Completions != 3 {
+		t.Errorf("unfiltered: %d completions, want 3", rows[0].Completions)
+	}
+}
+
+func TestCompletedGoals(t *testing.T) {
+	website := Website{Goals: []Goal{
+		{Name: "Any signup", Event: "signup"},
+		{Name: "Pro signup", Event: "signup", Props: map[string]string{"plan": "pro"}},
+		{Name: "Pricing", Page: "/pricing"},
+	}}
+	pv := PageView{PageURL: "https://example.com/pricing", Event: "signup", Props: map[string]string{"plan": "pro"}}
+	got := completedGoals(pv, website)
+	if len(got) != 2 || got[0] != "Any signup" || got[1] != "Pro signup" {
+		t.Errorf("completedGoals = %q, want both signup goals in configuration order", got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/base64" // For encoding registers in JSON
+	"encoding/binary" // For packing sparse registers
+	"encoding/json"   // For the JSON form of a sketch
+	"errors"          // For decoding errors
+	"hash/fnv"        // For hashing values
+	"math"            // For the cardinality estimate
+	"math/bits"       // For counting leading zeros
+)
+
+// =============================================================================
+// HYPERLOGLOG
+// =============================================================================
+
+// hllPrecision is the number of hash bits used to pick a register
+// 2^12 registers give a standard error of 1.04/sqrt(4096), about 1.6%
+const hllPrecision = 12
+
+// hllRegisters is the number of registers in every sketch
+const hllRegisters = 1 << hllPrecision
+
+// hllStandardError is the relative standard error of a count
+var hllStandardError = 1.04 / math.Sqrt(hllRegisters)
+
+// hyperLogLog estimates the number of distinct values added to it in fixed memory
+// Sketches built from different days can be merged to count distinct values across them.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// newHLL creates an empty sketch
+func newHLL() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+// hash64 hashes a value with FNV-1a and mixes the result so every bit is usable
+// The hash must never change, or stored sketches would stop merging correctly
+func hash64(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+	// splitmix64 finalizer: FNV's high bits alone are not uniform enough for register selection
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// add records a value in the sketch
+func (h *hyperLogLog) add(value string) {
+	x := hash64(value)
+	index := x >> (64 - hllPrecision)
+	// The guard bit caps the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// merge folds another sketch into this one, giving the sketch of the union of both sets
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// count estimates the number of distinct values added
+// Small counts use linear counting, which is more accurate while many registers are still empty
+func (h *hyperLogLog) count() uint64 {
+	m := float64(hllRegisters)
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Sketches are stored as base64 strings. Most sketches in a day's breakdown hold a handful of
+// values, so they are written sparse ("S" + index/rank triples) unless dense ("D" + all registers) is smaller.
+const (
+	hllDense  = 'D'
+	hllSparse = 'S'
+)
+
+// MarshalJSON encodes the sketch in whichever of the dense and sparse forms is smaller
+func (h *hyperLogLog) MarshalJSON() ([]byte, error) {
+	sparse := []byte{hllSparse}
+	for i, r := range h.registers {
+		if r != 0 {
+			sparse = binary.BigEndian.AppendUint16(sparse, uint16(i))
+			sparse = append(sparse, r)
+		}
+	}
+	data := sparse
+	if len(sparse) > 1+hllRegisters {
+		data = append([]byte{hllDense}, h.registers...)
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(data))
+}
+
+// UnmarshalJSON decodes either form written by MarshalJSON
+func (h *hyperLogLog) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err != nil {
+		return err
+	}
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("empty sketch")
+	}
+
+	h.registers = make([]uint8, hllRegisters)
+	switch data[0] {
+	case hllDense:
+		if len(data) != 1+hllRegisters {
+			return errors.New("dense sketch has the wrong number of registers")
+		}
+		copy(h.registers, data[1:])
+	case hllSparse:
+		if (len(data)-1)%3 != 0 {
+			return errors.New("truncated sparse sketch")
+		}
+		for i := 1; i < len(data); i += 3 {
+			index := binary.BigEndian.Uint16(data[i:])
+			if int(index) >= hllRegisters {
+				return errors.New("sparse sketch register out of range")
+			}
+			h.registers[index] = data[i+2]
+		}
+	default:
+		return errors.New("unknown sketch encoding")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"           // For comparing registers
+	"encoding/base64" // For inspecting the stored form
+	"encoding/json"   // For round-tripping sketches
+	"fmt"             // For generating distinct values
+	"math"            // For error bounds
+	"testing"         // For the test runner
+)
+
+// =============================================================================
+// HYPERLOGLOG TESTS
+// =============================================================================
+
+// sketchOf returns a sketch holding the values prefix-from to prefix-(to-1)
+func sketchOf(prefix string, from, to int) *hyperLogLog {
+	h := newHLL()
+	for i := from; i < to; i++ {
+		h.add(fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return h
+}
+
+func TestHLLAccuracy(t *testing.T) {
+	for _, n := range []int{0, 1, 5, 50, 500, 5000, 50000, 250000} {
+		h := sketchOf("visitor", 0, n)
+		// Adding values again does not change the count
+		for i := 0; i < n && i < 1000; i++ {
+			h.add(fmt.Sprintf("visitor-%d", i))
+		}
+		got := float64(h.count())
+		// Three standard errors, and at least one value either way for tiny counts
+		tolerance := math.Max(3*hllStandardError*float64(n), 1)
+		if math.Abs(got-float64(n)) > tolerance {
+			t.Errorf("count of %d distinct values = %v, want within %.0f", n, got, tolerance)
+		}
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	// Two overlapping days: 0-29999 and 20000-49999, so 50000 distinct values in total
+	monday, tuesday := sketchOf("v", 0, 30000), sketchOf("v", 20000, 50000)
+	union := sketchOf("v", 0, 50000)
+
+	merged := newHLL()
+	merged.merge(monday)
+	merged.merge(tuesday)
+	if !bytes.Equal(merged.registers, union.registers) {
+		t.Error("merged sketch differs from the sketch of the union")
+	}
+	if got := float64(merged.count()); math.Abs(got-50000) > 3*hllStandardError*50000 {
+		t.Errorf("merged count = %v, want about 50000", got)
+	}
+
+	// Merging is idempotent and order does not matter
+	reversed := newHLL()
+	reversed.merge(tuesday)
+	reversed.merge(monday)
+	reversed.merge(monday)
+	if !bytes.Equal(reversed.registers, merged.registers) {
+		t.Error("merge depends on order or repetition")
+	}
+	if monday.count() > merged.count() {
+		t.Error("merging lowered the count")
+	}
+}
+
+func TestHLLJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		sketch   *hyperLogLog
+		encoding byte
+	}{
+		{name: "empty", sketch: newHLL(), encoding: hllSparse},
+		{name: "small sketch is sparse", sketch: sketchOf("v", 0, 20), encoding: hllSparse},
+		{name: "large sketch is dense", sketch: sketchOf("v", 0, 20000), encoding: hllDense},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.sketch)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var text string
+			json.Unmarshal(data, &text)
+			raw, _ := base64.StdEncoding.DecodeString(text)
+			if len(raw) == 0 || raw[0] != tt.encoding {
+				t.Errorf("stored form starts with %q, want %q", raw[:min(len(raw), 1)], tt.encoding)
+			}
+			if len(raw) > 1+hllRegisters {
+				t.Errorf("stored form is %d bytes, larger than the dense form", len(raw))
+			}
+
+			decoded := newHLL()
+			if err := json.Unmarshal(data, decoded); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !bytes.Equal(decoded.registers, tt.sketch.registers) {
+				t.Error("registers changed in the round trip")
+			}
+		})
+	}
+}
+
+func TestHLLUnmarshalErrors(t *testing.T) {
+	encode := func(data []byte) string {
+		return `"` + base64.StdEncoding.EncodeToString(data) + `"`
+	}
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "not a string", json: `42`},
+		{name: "not base64", json: `"!!!"`},
+		{name: "empty", json: `""`},
+		{name: "unknown encoding", json: encode([]byte{'X', 0, 1, 2})},
+		{name: "short dense", json: encode(append([]byte{hllDense}, make([]byte, 10)...))},
+		{name: "truncated sparse", json: encode([]byte{hllSparse, 0, 1})},
+		{name: "sparse index out of range", json: encode([]byte{hllSparse, 0xFF, 0xFF, 3})},
+	}
+	for _, tt := range tests {
+		var h hyperLogLog
+		if err := json.Unmarshal([]byte(tt.json), &h); err == nil {
+			t.Errorf("%s: Unmarshal(%s) succeeded, want an error", tt.name, tt.json)
+		}
+	}
+}
@@ -16,9 +16,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"   // For JSON marshaling/unmarshaling
+	"errors"          // For checking file errors
 	"fmt"             // For string formatting and printing
 	"html/template"   // For rendering HTML templates
 	"log"             // For logging errors and info
+	"net"             // For parsing IP addresses
 	"net/http"        // For HTTP server functionality
 	"os"              // For file operations and environment variables
 	"path/filepath"   // For cross-platform file path operations
@@ -26,6 +28,7 @@ import (
 	"strings"         // For string manipulation
 	"sync"            // For thread-safe operations
 	"time"            // For timestamp handling
+	"unicode/utf8"    // For truncating property values on character boundaries
 
 	"github.com/gorilla/mux" // HTTP router for URL routing
 )
@@ -37,47 +40,205 @@ import (
 // Website represents a registered website that can be tracked
 // Each website has a unique ID used for tracking validation
 type Website struct {
-	ID     string `json:"id"`     // Unique identifier for tracking (e.g., "my-website")
-	Domain string `json:"domain"` // Domain name (e.g., "localhost", "example.com")
-	Name   string `json:"name"`   // Human-readable name (e.g., "My Blog")
+	ID     string `json:"id"`                // Unique identifier for tracking (e.g., "my-website")
+	Domain string `json:"domain"`            // Domain name (e.g., "localhost", "example.com")
+	Name   string `json:"name"`              // Human-readable name (e.g., "My Blog")
+	IPMode string `json:"ip_mode,omitempty"` // How visitor IPs are stored: full, truncate, hash or drop (default)
+
+	RespectDNT bool        `json:"respect_dnt,omitempty"` // Skip tracking when the browser sends DNT: 1 or Sec-GPC: 1
+	Scrub      *ScrubRules `json:"scrub,omitempty"`       // Query-string and PII scrubbing applied to URLs before storage
+
+	// ConsentMode gates tracking on Analytics.consent(true): "" (off), "required" or "anonymous"
+	// In anonymous mode, hits before consent are stored without session, visitor, IP or user agent
+	ConsentMode string `json:"consent_mode,omitempty"`
+
+	// Timezone is the IANA time zone used for date ranges and day buckets (default UTC)
+	Timezone string `json:"timezone,omitempty"`
+
+	// Goals are the conversions reported for this website (page visits or custom events)
+	Goals []Goal `json:"goals,omitempty"`
+
+	// Funnels are ordered sequences of goal-like steps reported by /stats/{id}/funnels
+	Funnels []Funnel `json:"funnels,omitempty"`
 }
 
 // PageView represents a single page visit with all tracking data
 // This is the core data structure for analytics tracking
 type PageView struct {
-	ID        string    `json:"id"`         // Unique ID for this page view
-	WebsiteID string    `json:"website_id"` // Links to Website.ID for validation
-	SessionID string    `json:"session_id"` // Browser session identifier
-	PageURL   string    `json:"page_url"`   // Full URL of the visited page
-	PageTitle string    `json:"page_title"` // HTML title of the page
-	Referrer  string    `json:"referrer"`   // URL that referred the user (if any)
-	IPAddress string    `json:"ip_address"` // Visitor's IP address
-	UserAgent string    `json:"user_agent"` // Browser's user agent string
-	Browser   string    `json:"browser"`    // Parsed browser name (Chrome, Firefox, etc.)
-	Timestamp time.Time `json:"timestamp"`  // When the page view occurred
+	ID        string    `json:"id"`              // Unique ID for this page view
+	WebsiteID string    `json:"website_id"`      // Links to Website.ID for validation
+	SessionID string    `json:"session_id"`      // Browser session identifier
+	VisitorID string    `json:"visitor_id"`      // Daily-rotating hash identifying the visitor across tabs
+	PageURL   string    `json:"page_url"`        // Full URL of the visited page
+	PageTitle string    `json:"page_title"`      // HTML title of the page
+	Referrer  string    `json:"referrer"`        // URL that referred the user (if any)
+	IPAddress string    `json:"ip_address"`      // Visitor's IP address, stored according to the website's IP mode
+	UserAgent string    `json:"user_agent"`      // Browser's user agent string
+	Browser   string    `json:"browser"`         // Parsed browser name (Chrome, Firefox, etc.)
+	Event     string    `json:"event,omitempty"` // Empty for a page view, "404" for a not-found page, otherwise a custom event name
+	Timestamp time.Time `json:"timestamp"`       // When the page view occurred
+
+	// Props holds custom event properties sent with Analytics.track(name, props)
+	Props map[string]string `json:"props,omitempty"`
+
+	// UserID is a pseudonymous hash of the ID the site passed to Analytics.identify (see userHash)
+	// Unlike VisitorID it is stable across days, so retention can be measured for signed-in users
+	UserID string `json:"user_id,omitempty"`
+
+	// TrackingMode records how the hit was collected: "standard" (no consent gate),
+	// "consented" (after Analytics.consent(true)) or "anonymous" (aggregate-only, before consent)
+	TrackingMode string `json:"tracking_mode,omitempty"`
+
+	// Platform details parsed from the user agent at ingest time
+	BrowserVersion string `json:"browser_version"` // Browser version (e.g., "120", "17.2")
+	OS             string `json:"os"`              // Operating system (Windows, iOS, Android, etc.)
+	OSVersion      string `json:"os_version"`      // Operating system version
+	Device         string `json:"device"`          // Device class: desktop, mobile, tablet or bot
+
+	// Campaign parameters parsed from the page URL at ingest time
+	UTMSource   string `json:"utm_source,omitempty"`   // Traffic source (utm_source, ref, or click ID platform)
+	UTMMedium   string `json:"utm_medium,omitempty"`   // Marketing medium (utm_medium)
+	UTMCampaign string `json:"utm_campaign,omitempty"` // Campaign name (utm_campaign)
+	UTMTerm     string `json:"utm_term,omitempty"`     // Paid search keyword (utm_term)
+	UTMContent  string `json:"utm_content,omitempty"`  // Ad or link variant (utm_content)
+
+	// Location resolved from the IP address when a GeoIP database is configured
+	Country string `json:"country,omitempty"` // ISO country code (e.g., "DE")
+	Region  string `json:"region,omitempty"`  // Region or state name
+	City    string `json:"city,omitempty"`    // City name
 }
 
+// eventNotFound marks a page view recorded on a page the site flagged as "not found"
+const eventNotFound = "404"
+
+// Limits on custom events, so a misbehaving page cannot bloat the data file
+const (
+	maxEventNameLength = 100
+	maxEventProps      = 30
+	maxPropValueLength = 500
+	maxUserIDLength    = 256
+)
+
+// truncateText shortens text to at most maxBytes bytes without splitting a multi-byte character
+func truncateText(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut-- // Step back to the first byte of the character that crosses the limit
+	}
+	return text[:cut]
+}
+
+// isPageView reports whether a record is a page load (including 404 pages) rather than a custom event
+func isPageView(pv PageView) bool {
+	return pv.Event == "" || pv.Event == eventNotFound
+}
+
+// Consent modes for Website.ConsentMode and tracking modes for PageView.TrackingMode
+const (
+	consentRequired  = "required"
+	consentAnonymous = "anonymous"
+
+	modeStandard  = "standard"
+	modeConsented = "consented"
+	modeAnonymous = "anonymous"
+)
+
 // Stats represents aggregated analytics data for API responses
 // This structure is returned by the /stats/{trackingId} endpoint
 type Stats struct {
+	// Range is the reporting period the stats cover
+	Range DateRange `json:"range"`
+
+	// Compare is the period the stats are compared against (only with ?compare=previous|year)
+	Compare *DateRange `json:"compare,omitempty"`
+
 	// Summary contains high-level metrics
 	Summary struct {
-		TotalViews      int `json:"total_views"`      // Total page views in time period
-		UniqueSessions  int `json:"unique_sessions"`  // Number of unique visitor sessions
-		DaysWithTraffic int `json:"days_with_traffic"` // Days that had at least one visit
+		TotalViews       int     `json:"total_views"`       // Total page views in the period
+		UniqueSessions   int     `json:"unique_sessions"`   // Number of unique visitor sessions
+		UniqueVisitors   int     `json:"unique_visitors"`   // Number of unique visitors (distinct daily visitor IDs)
+		UniquesEstimated bool    `json:"uniques_estimated"` // Unique sessions and visitors are sketch estimates (about ±1.6%)
+		DaysWithTraffic  int     `json:"days_with_traffic"` // Days that had at least one visit
+		OptOuts          int     `json:"opt_outs"`          // Hits suppressed because of DNT/GPC (whole days in the period)
+		OptOutRate       float64 `json:"opt_out_rate"`      // Percentage of all hits that were suppressed
+
+		// Engagement, computed from each session's page views ordered by time
+		BounceRate            float64 `json:"bounce_rate"`             // Percentage of sessions with a single page view
+		ViewsPerSession       float64 `json:"views_per_session"`       // Average page views per session
+		AvgSessionDuration    float64 `json:"avg_session_duration"`    // Average time from first to last page view, in seconds
+		MedianSessionDuration float64 `json:"median_session_duration"` // Median session duration in seconds
+
+		// Changes compares each metric with the comparison period (only with ?compare)
+		Changes *SummaryChanges `json:"changes,omitempty"`
 	} `json:"summary"`
 	
 	// TopPages lists the most visited pages (limited to top 10)
 	TopPages []struct {
-		PageURL string `json:"page_url"` // URL of the page
-		Views   int    `json:"views"`    // Number of views for this page
+		PageURL string  `json:"page_url"`         // URL of the page
+		Views   int     `json:"views"`            // Number of views for this page
+		Change  *Change `json:"change,omitempty"` // Change in views (only with ?compare)
 	} `json:"top_pages"`
 	
 	// Browsers lists browser usage statistics
 	Browsers []struct {
-		Browser string `json:"browser"` // Browser name (Chrome, Firefox, etc.)
-		Count   int    `json:"count"`   // Number of visits from this browser
+		Browser string  `json:"browser"`          // Browser name (Chrome, Firefox, etc.)
+		Count   int     `json:"count"`            // Number of visits from this browser
+		Change  *Change `json:"change,omitempty"` // Change in visits (only with ?compare)
 	} `json:"browsers"`
+
+	// LandingPages reports engagement for sessions by the page they started on (limited to top 10)
+	LandingPages []LandingPageRow `json:"landing_pages"`
+
+	// Goals reports completions and conversion rate for each of the website's goals
+	Goals []GoalRow `json:"goals"`
+
+	// Events lists custom events by name (limited to top 10)
+	Events []BreakdownRow `json:"events"`
+
+	// BrokenPages lists the most requested not-found URLs (limited to top 10)
+	BrokenPages []BrokenPage `json:"broken_pages"`
+
+	// Campaigns, Sources and Mediums break down UTM-tagged traffic
+	Campaigns []BreakdownRow `json:"campaigns"`
+	Sources   []BreakdownRow `json:"sources"`
+	Mediums   []BreakdownRow `json:"mediums"`
+
+	// Referrers lists external referrer sources; Channels groups all traffic by acquisition channel
+	Referrers []ReferrerRow  `json:"referrers"`
+	Channels  []BreakdownRow `json:"channels"`
+
+	// OperatingSystems and Devices break down visits by platform
+	OperatingSystems []BreakdownRow `json:"operating_systems"`
+	Devices          []BreakdownRow `json:"devices"`
+
+	// Countries and Regions break down visits by location (requires a GeoIP database)
+	Countries []BreakdownRow `json:"countries"`
+	Regions   []BreakdownRow `json:"regions"`
+}
+
+// BreakdownRow is a single row of a dimension breakdown report
+type BreakdownRow struct {
+	Name     string  `json:"name"`             // Dimension value (e.g., campaign name)
+	Views    int     `json:"views"`            // Page views with this value
+	Sessions int     `json:"sessions"`         // Unique sessions with this value
+	Change   *Change `json:"change,omitempty"` // Change in views (only with ?compare)
+}
+
+// BrokenPage summarizes hits on a single URL that was reported as a 404
+type BrokenPage struct {
+	PageURL   string          `json:"page_url"`         // URL that was requested but not found
+	Views     int             `json:"views"`            // Number of times the URL was hit
+	Referrers []ReferrerCount `json:"referrers"`        // Pages linking to the broken URL, most frequent first
+	Change    *Change         `json:"change,omitempty"` // Change in hits (only with ?compare)
+}
+
+// ReferrerCount pairs a referring URL with the number of hits it sent
+type ReferrerCount struct {
+	Referrer string `json:"referrer"` // Referring URL
+	Count    int    `json:"count"`    // Number of hits from this referrer
 }
 
 // =============================================================================
@@ -140,12 +301,24 @@ func readJSONFile(filename string, v interface{}) error {
 	// Acquire read lock - multiple readers can access simultaneously
 	mutex.RLock()
 	defer mutex.RUnlock() // Ensure lock is released when function exits
+	return readJSONData(filename, v)
+}
 
+// readJSONData reads, decrypts and unmarshals a JSON file; the caller must hold mutex
+func readJSONData(filename string, v interface{}) error {
 	// Read the entire file into memory
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("failed to read file %s: %w", filename, err)
 	}
+
+	// Encrypted files are recognized by their header, so plaintext files written before
+	// encryption was enabled can still be read
+	if isEncrypted(data) {
+		if data, err = decryptData(data, dataKeys); err != nil {
+			return fmt.Errorf("failed to read file %s: %w", filename, err)
+		}
+	}
 	
 	// Parse JSON data into the provided interface
 	return json.Unmarshal(data, v)
@@ -157,33 +330,80 @@ func writeJSONFile(filename string, v interface{}) error {
 	// Acquire write lock - only one writer allowed, blocks all readers
 	mutex.Lock()
 	defer mutex.Unlock() // Ensure lock is released when function exits
+	return writeJSONData(filename, v)
+}
 
+// writeJSONData marshals, encrypts and writes a JSON file; the caller must hold mutex for writing
+func writeJSONData(filename string, v interface{}) error {
 	// Marshal data to pretty-printed JSON (2-space indentation)
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
+
+	// Encrypt page view data when an encryption key is configured
+	if shouldEncrypt(filename) {
+		if data, err = encryptData(data, dataKeys.primary); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filename, err)
+		}
+	} else if fileIsEncrypted(filename) {
+		// Never replace encrypted data with plaintext, e.g. after a restart without the key
+		return fmt.Errorf("failed to write %s: %w", filename, errPlaintextOverEncrypted)
+	}
 	
-	// Write JSON data to file with 0644 permissions (owner read/write, group/others read)
-	return os.WriteFile(filename, data, 0644)
+	// Write JSON data to file with 0644 permissions (owner read/write, group/others read),
+	// or 0600 for files holding secrets
+	if !isPrivateFile(filename) {
+		return os.WriteFile(filename, data, 0644)
+	}
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile only applies the mode to new files, so tighten files created by older versions
+	return os.Chmod(filename, 0600)
 }
 
-// getBrowser attempts to identify the browser from the user-agent string
-// It returns a simplified browser name (e.g., "Chrome", "Firefox")
-func getBrowser(userAgent string) string {
-	ua := strings.ToLower(userAgent)
-	switch {
-	case strings.Contains(ua, "chrome") && !strings.Contains(ua, "edg"):
-		return "Chrome"
-	case strings.Contains(ua, "firefox"):
-		return "Firefox"
-	case strings.Contains(ua, "safari") && !strings.Contains(ua, "chrome"):
-		return "Safari"
-	case strings.Contains(ua, "edg"):
-		return "Edge"
-	default:
-		return "Other"
+// isPrivateFile reports whether a data file must only be readable by its owner (see privateFiles)
+func isPrivateFile(filename string) bool {
+	for _, name := range privateFiles {
+		if name == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePageViews reads, changes and writes the page view file under one write lock,
+// so concurrent tracking requests and deletions cannot overwrite each other's changes.
+// A missing file is treated as empty; any other read error (e.g. an encrypted file without
+// its key) aborts without writing, since starting over would discard every stored page view.
+func updatePageViews(update func([]PageView) []PageView) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var pageViews []PageView
+	if err := readJSONData(pageViewsFile, &pageViews); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		pageViews = []PageView{}
 	}
+	return writeJSONData(pageViewsFile, update(pageViews))
+}
+
+// findWebsite looks up a registered website by its tracking ID
+// The boolean result is false if no website with that ID exists
+func findWebsite(trackingID string) (Website, bool, error) {
+	var websites []Website
+	if err := readJSONFile(websitesFile, &websites); err != nil {
+		return Website{}, false, err
+	}
+	for _, website := range websites {
+		if website.ID == trackingID {
+			return website, true, nil
+		}
+	}
+	return Website{}, false, nil
 }
 
 // generateID creates a unique ID based on the current Unix timestamp
@@ -199,15 +419,19 @@ func getClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header, common for proxies
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		// The first IP in the list is the original client IP
-		return strings.Split(xff, ",")[0]
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
 	}
 	// Check X-Real-IP header, another common proxy header
 	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+		return strings.TrimSpace(xri)
 	}
 	// Fallback to the remote address from the TCP connection
 	// This may be the proxy's IP, not the user's
-	return strings.Split(r.RemoteAddr, ":")[0]
+	// SplitHostPort handles bracketed IPv6 addresses such as "[::1]:8080"
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
 }
 
 // =============================================================================
@@ -242,13 +466,18 @@ func trackHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Define a temporary struct to decode incoming JSON data
 	var data struct {
-		TrackingID string `json:"tracking_id"`
-		SessionID  string `json:"session_id"`
-		PageURL    string `json:"page_url"`
-		PageTitle  string `json:"page_title"`
-		Referrer   string `json:"referrer"`
-		UserAgent  string `json:"user_agent"`
-		Timestamp  string `json:"timestamp"` // Received as string, then parsed
+		TrackingID string                 `json:"tracking_id"`
+		SessionID  string                 `json:"session_id"`
+		PageURL    string                 `json:"page_url"`
+		PageTitle  string                 `json:"page_title"`
+		Referrer   string                 `json:"referrer"`
+		UserAgent  string                 `json:"user_agent"`
+		Event      string                 `json:"event"`     // Optional event type ("404" or a custom event name)
+		Props      map[string]interface{} `json:"props"`     // Optional custom event properties
+		UserID     string                 `json:"user_id"`   // Optional stable user ID from Analytics.identify
+		OptOut     bool                   `json:"opt_out"`   // Set by the script when the browser sent a DNT/GPC signal
+		Mode       string                 `json:"mode"`      // "consented" or "anonymous" when the website uses a consent gate
+		Timestamp  string                 `json:"timestamp"` // Received as string, then parsed
 	}
 
 	// Decode the JSON request body into the temporary struct
@@ -259,23 +488,44 @@ func trackHandler(w http.ResponseWriter, r *http.Request) {
 
 	// --- Validation Step ---
 	// Verify that the tracking ID corresponds to a registered website
-	var websites []Website
-	if err := readJSONFile(websitesFile, &websites); err != nil {
+	website, found, err := findWebsite(data.TrackingID)
+	if err != nil {
 		http.Error(w, "Server error: could not read websites file", http.StatusInternalServerError)
 		return
 	}
 
-	// Check if the provided tracking ID exists
-	found := false
-	for _, website := range websites {
-		if website.ID == data.TrackingID {
-			found = true
-			break
+	if !found {
+		http.Error(w, "Invalid tracking ID", http.StatusBadRequest)
+		return
+	}
+
+	// --- Privacy Signals ---
+	// Honor Do Not Track / Global Privacy Control: count the hit, but store nothing about it
+	// An opt-out ping from the script carries no page data, so it is never stored either way
+	if data.OptOut || (website.RespectDNT && hasOptOutSignal(r)) {
+		if website.RespectDNT {
+			if err := recordOptOut(website.ID, time.Now()); err != nil {
+				log.Printf("Error recording opt-out: %v", err)
+			}
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+		return
 	}
 
-	if !found {
-		http.Error(w, "Invalid tracking ID", http.StatusBadRequest)
+	// --- Consent ---
+	// Decide how this hit may be stored based on the website's consent gate
+	mode := modeStandard
+	switch {
+	case website.ConsentMode == "":
+	case data.Mode == modeConsented:
+		mode = modeConsented
+	case website.ConsentMode == consentAnonymous:
+		mode = modeAnonymous
+	default:
+		// Consent is required and was not given: store nothing
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
 		return
 	}
 
@@ -287,138 +537,367 @@ func trackHandler(w http.ResponseWriter, r *http.Request) {
 		timestamp = time.Now()
 	}
 
+	// Validate custom events and flatten their properties to strings
+	event := strings.TrimSpace(data.Event)
+	if len(event) > maxEventNameLength || len(data.Props) > maxEventProps {
+		http.Error(w, "Event name or properties too large", http.StatusBadRequest)
+		return
+	}
+	var props map[string]string
+	if event != "" && event != eventNotFound && len(data.Props) > 0 {
+		props = make(map[string]string, len(data.Props))
+		for key, value := range data.Props {
+			props[key] = truncateText(fmt.Sprint(value), maxPropValueLength)
+		}
+	}
+
+	if len(data.UserID) > maxUserIDLength {
+		http.Error(w, "User ID too long", http.StatusBadRequest)
+		return
+	}
+
+	// Extract campaign parameters before the URL is scrubbed and stored
+	campaign := parseCampaign(data.PageURL)
+
+	// Parse browser, OS and device details from the user agent
+	ua := parseUserAgent(data.UserAgent)
+
+	// Derive everything that needs the raw IP address up front; only the anonymized form is stored
+	ipAddress := getClientIP(r)
+	location := lookupGeo(ipAddress)
+	visitor, user := "", ""
+	if mode != modeAnonymous {
+		if visitor, err = visitorID(data.TrackingID, ipAddress, data.UserAgent); err != nil {
+			log.Printf("Error computing visitor ID: %v", err)
+		}
+		user = userHash(data.TrackingID, data.UserID)
+	}
+
 	// Create a new PageView record from the validated data
 	pageView := PageView{
 		ID:        generateID(),
 		WebsiteID: data.TrackingID,
 		SessionID: data.SessionID,
-		PageURL:   data.PageURL,
+		VisitorID: visitor,
+		IPAddress: anonymizeIP(ipAddress, ipMode(website)),
+		PageURL:   scrubURL(data.PageURL, website.Scrub),
 		PageTitle: data.PageTitle,
-		Referrer:  data.Referrer,
-		IPAddress: getClientIP(r),
+		Referrer:  scrubURL(data.Referrer, website.Scrub),
 		UserAgent: data.UserAgent,
-		Browser:   getBrowser(data.UserAgent),
+		Browser:   ua.Browser,
+		Event:     event,
+		Props:     props,
 		Timestamp: timestamp,
-	}
 
-	// --- Data Storage ---
-	// Read existing page views from the file
-	var pageViews []PageView
-	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
-		// If file doesn't exist or is empty, initialize an empty slice
-		pageViews = []PageView{}
-	}
+		UserID: user,
+
+		BrowserVersion: ua.BrowserVersion,
+		OS:             ua.OS,
+		OSVersion:      ua.OSVersion,
+		Device:         ua.Device,
+
+		TrackingMode: mode,
 
-	// Append the new page view to the slice
-	pageViews = append(pageViews, pageView)
+		Country: location.Country,
+		Region:  location.Region,
+		City:    location.City,
 
-	// Data Retention: Keep only the last 10,000 records to prevent the file from growing indefinitely
-	if len(pageViews) > 10000 {
-		pageViews = pageViews[len(pageViews)-10000:]
+		UTMSource:   campaign.Source,
+		UTMMedium:   campaign.Medium,
+		UTMCampaign: campaign.Name,
+		UTMTerm:     campaign.Term,
+		UTMContent:  campaign.Content,
 	}
 
-	// Save the updated slice back to the JSON file
-	if err := writeJSONFile(pageViewsFile, pageViews); err != nil {
+	// Anonymous hits keep only aggregate fields; nothing that could identify or link a visitor
+	if mode == modeAnonymous {
+		pageView.SessionID = ""
+		pageView.IPAddress = ""
+		pageView.UserAgent = ""
+	}
+
+	// --- Data Storage ---
+	// Append the page view to the file in a single read-modify-write
+	err = updatePageViews(func(pageViews []PageView) []PageView {
+		pageViews = append(pageViews, pageView)
+
+		// Data Retention: Keep only the last 10,000 records to prevent the file from growing indefinitely
+		if len(pageViews) > 10000 {
+			pageViews = pageViews[len(pageViews)-10000:]
+		}
+		return pageViews
+	})
+	if err != nil {
+		log.Printf("Error saving page view: %v", err)
 		http.Error(w, "Server error: could not save page view", http.StatusInternalServerError)
 		return
 	}
 
+	// Push the hit to live dashboards, which filter and sanitize it for their subscribers
+	live.publish(pageView)
+
+	// Add the hit to the unique count sketches; the page view itself is already saved
+	if err := recordSketch(pageView, website); err != nil {
+		log.Printf("Error updating sketches: %v", err)
+	}
+
 	// Respond with a success message
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
 // statsHandler serves aggregated analytics data as a JSON response.
-// It calculates stats for a given tracking ID over the last 30 days.
+// It calculates stats for a given tracking ID over the requested period (last 30 days by default).
 func statsHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract trackingId from the URL (e.g., /stats/my-website)
-	vars := mux.Vars(r)
-	trackingID := vars["trackingId"]
+	// Resolve the website, reporting time zone and date range from the query string
+	// (e.g., /stats/my-website?period=7d or ?from=2024-01-01&to=2024-01-31)
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
 
-	// Read all page views from the data file
-	var pageViews []PageView
-	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
-		http.Error(w, "Server error: could not read page views", http.StatusInternalServerError)
+	stats, err := buildStats(query, 10)
+	if err != nil {
+		writeQueryError(w, err)
 		return
 	}
 
-	// --- Data Aggregation ---
-	// Filter page views for the requested website and within the last 30 days
-	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
-	var recentViews []PageView
-	for _, pv := range pageViews {
-		if pv.WebsiteID == trackingID && pv.Timestamp.After(thirtyDaysAgo) {
-			recentViews = append(recentViews, pv)
+	// Optionally compare against the previous period or the same period last year (?compare=previous|year)
+	if previousQuery, ok := query.comparison(); ok {
+		// Every row is kept so rows that fell out of the top 10 still have a previous value
+		previous, err := buildStats(previousQuery, 0)
+		if err != nil {
+			writeQueryError(w, err)
+			return
 		}
+		stats.compareWith(previous)
 	}
 
+	// Send the response as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// buildStats aggregates the page views matching a report query into the stats response
+// Breakdowns are cut to the given number of rows; a limit of 0 keeps every row
+func buildStats(query reportQuery, limit int) (Stats, error) {
+	website := query.Website
+
+	// --- Data Aggregation ---
+	// Read page views for the requested website within the date range that pass the filters
+	// Custom events are reported separately from page view metrics
+	rangeViews, err := loadRangeViews(query)
+	if err != nil {
+		return Stats{}, err
+	}
+	records := applyFilters(rangeViews, query.Filters, website)
+	recentViews := pageViewsOnly(records)
+
 	// Calculate statistics from the filtered page views
 	totalViews := len(recentViews)
 	sessionSet := make(map[string]bool)
+	visitorSet := make(map[string]bool)
 	daySet := make(map[string]bool)
-	pageStats := make(map[string]int)
-	browserStats := make(map[string]int)
 
 	for _, pv := range recentViews {
-		sessionSet[pv.SessionID] = true
-		daySet[pv.Timestamp.Format("2006-01-02")] = true
-		pageStats[pv.PageURL]++
-		browserStats[pv.Browser]++
+		// Anonymous hits have no session ID and are not counted as sessions
+		if pv.SessionID != "" {
+			sessionSet[pv.SessionID] = true
+		}
+		// Records from before visitor IDs existed have no ID and are not counted
+		if pv.VisitorID != "" {
+			visitorSet[pv.VisitorID] = true
+		}
+		// Days are bucketed in the website's reporting time zone
+		daySet[query.day(pv.Timestamp)] = true
 	}
 
 	// --- Response Building ---
 	// Populate the Stats structure for the JSON response
 	var stats Stats
+	stats.Range = query.dateRange()
 	stats.Summary.TotalViews = totalViews
 	stats.Summary.UniqueSessions = len(sessionSet)
+	stats.Summary.UniqueVisitors = len(visitorSet)
 	stats.Summary.DaysWithTraffic = len(daySet)
 
-	// Aggregate and sort top pages (up to 10)
-	type pageCount struct {
-		URL   string
-		Count int
+	// Unfiltered whole-day ranges count uniques from the day sketches, which keep covering
+	// days whose page views have dropped out of the capped page view file
+	estimatedSessions, estimatedVisitors, estimated, err := estimateUniques(query)
+	if err != nil {
+		log.Printf("Error reading sketches: %v", err)
+	} else if estimated {
+		stats.Summary.UniqueSessions, stats.Summary.UniqueVisitors = estimatedSessions, estimatedVisitors
+		stats.Summary.UniquesEstimated = true
 	}
-	var pages []pageCount
-	for url, count := range pageStats {
-		pages = append(pages, pageCount{URL: url, Count: count})
+
+	// Report how many hits were suppressed by DNT/GPC alongside the tracked ones
+	optOuts, err := countOptOuts(website.ID, query.Start, query.End)
+	if err != nil {
+		log.Printf("Error reading opt-out counts: %v", err)
+	}
+	stats.Summary.OptOuts = optOuts
+	if optOuts+totalViews > 0 {
+		stats.Summary.OptOutRate = float64(optOuts) * 100 / float64(optOuts+totalViews)
 	}
-	sort.Slice(pages, func(i, j int) bool {
-		return pages[i].Count > pages[j].Count
-	})
 
+	// Group page views into sessions for engagement metrics
+	// Filters select the sessions; each selected session keeps all of its page views
+	sessions := groupSessions(pageViewsOnly(sessionRecords(rangeViews, records)))
+	engagement := sessionMetrics(sessions)
+	stats.Summary.BounceRate = engagement.BounceRate
+	stats.Summary.ViewsPerSession = engagement.ViewsPerSession
+	stats.Summary.AvgSessionDuration = engagement.AvgSessionDuration
+	stats.Summary.MedianSessionDuration = engagement.MedianSessionDuration
+	stats.LandingPages = landingPages(sessions, limit)
+
+	// Top pages by full URL, limited like the other breakdowns
+	pages := dimensionRows(recentViews, "url", website)
+	sortDimensionRows(pages, "views")
 	for i, page := range pages {
-		if i >= 10 {
-			break // Limit to top 10
+		if limit > 0 && i >= limit {
+			break // Limit to top pages
 		}
 		stats.TopPages = append(stats.TopPages, struct {
-			PageURL string `json:"page_url"`
-			Views   int    `json:"views"`
-		}{PageURL: page.URL, Views: page.Count})
+			PageURL string  `json:"page_url"`
+			Views   int     `json:"views"`
+			Change  *Change `json:"change,omitempty"`
+		}{PageURL: page.Name, Views: page.Views})
 	}
 
-	// Aggregate and sort browser stats
-	type browserCount struct {
-		Browser string
-		Count   int
+	// Every browser is listed; /stats/{id}/breakdown?dimension=browser pages through them instead
+	browsers := dimensionRows(recentViews, "browser", website)
+	sortDimensionRows(browsers, "views")
+	for _, browser := range browsers {
+		stats.Browsers = append(stats.Browsers, struct {
+			Browser string  `json:"browser"`
+			Count   int     `json:"count"`
+			Change  *Change `json:"change,omitempty"`
+		}{Browser: browser.Name, Count: browser.Views})
 	}
-	var browsers []browserCount
-	for browser, count := range browserStats {
-		browsers = append(browsers, browserCount{Browser: browser, Count: count})
+
+	// Count custom events by name; 404 hits are page views and are reported as broken pages instead
+	stats.Events = breakdown(records, func(pv PageView) string {
+		if isPageView(pv) {
+			return ""
+		}
+		return pv.Event
+	}, limit)
+
+	// Report every configured goal, including those with no completions
+	// Like session metrics, goals see every record of the selected sessions, not just the matching ones
+	// Conversion rates use the exact session count, since completions are counted exactly
+	stats.Goals = goalReport(goalRecords(rangeViews, records), website.Goals, len(sessionSet))
+
+	// Aggregate the most frequently hit broken pages
+	stats.BrokenPages = brokenPages(recentViews, limit)
+
+	// Break down campaign traffic by UTM parameters
+	stats.Campaigns = breakdown(recentViews, func(pv PageView) string { return pv.UTMCampaign }, limit)
+	stats.Sources = breakdown(recentViews, func(pv PageView) string { return pv.UTMSource }, limit)
+	stats.Mediums = breakdown(recentViews, func(pv PageView) string { return pv.UTMMedium }, limit)
+
+	// Classify external referrers and group traffic into channels
+	stats.Referrers = referrerReport(recentViews, website, limit)
+	stats.Channels = breakdown(recentViews, func(pv PageView) string { return trafficChannel(pv, website) }, limit)
+
+	// Break down visits by operating system and device class
+	stats.OperatingSystems = breakdown(recentViews, func(pv PageView) string { return pv.OS }, limit)
+	stats.Devices = breakdown(recentViews, func(pv PageView) string { return pv.Device }, limit)
+
+	// Break down visits by location; regions carry their country code since names repeat across countries
+	stats.Countries = breakdown(recentViews, func(pv PageView) string { return pv.Country }, limit)
+	stats.Regions = breakdown(recentViews, regionName, limit)
+
+	return stats, nil
+}
+
+// brokenPages groups 404 events by URL and lists the referrers linking to each one.
+// Results are sorted by hit count and limited to the given number of pages (0 for no limit).
+func brokenPages(pageViews []PageView, limit int) []BrokenPage {
+	pageCounts := make(map[string]int)
+	referrerCounts := make(map[string]map[string]int)
+
+	for _, pv := range pageViews {
+		if pv.Event != eventNotFound {
+			continue
+		}
+		pageCounts[pv.PageURL]++
+		// Direct hits have no referrer and are not a link that can be fixed
+		if pv.Referrer == "" {
+			continue
+		}
+		if referrerCounts[pv.PageURL] == nil {
+			referrerCounts[pv.PageURL] = make(map[string]int)
+		}
+		referrerCounts[pv.PageURL][pv.Referrer]++
 	}
-	sort.Slice(browsers, func(i, j int) bool {
-		return browsers[i].Count > browsers[j].Count
+
+	pages := []BrokenPage{}
+	for url, count := range pageCounts {
+		page := BrokenPage{PageURL: url, Views: count, Referrers: []ReferrerCount{}}
+		for referrer, refCount := range referrerCounts[url] {
+			page.Referrers = append(page.Referrers, ReferrerCount{Referrer: referrer, Count: refCount})
+		}
+		sort.Slice(page.Referrers, func(i, j int) bool {
+			return page.Referrers[i].Count > page.Referrers[j].Count
+		})
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Views > pages[j].Views
 	})
 
-	for _, browser := range browsers {
-		stats.Browsers = append(stats.Browsers, struct {
-			Browser string `json:"browser"`
-			Count   int    `json:"count"`
-		}{Browser: browser.Browser, Count: browser.Count})
+	if limit > 0 && len(pages) > limit {
+		pages = pages[:limit]
 	}
+	return pages
+}
 
-	// Send the response as JSON
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+// regionName labels a page view's region with its country code (e.g., "Berlin, DE")
+func regionName(pv PageView) string {
+	if pv.Region == "" {
+		return ""
+	}
+	return pv.Region + ", " + pv.Country
+}
+
+// breakdown groups page views by the value returned from key and counts views and unique sessions.
+// Empty values are skipped. Results are sorted by views and limited to the given number of rows (0 for no limit).
+func breakdown(pageViews []PageView, key func(PageView) string, limit int) []BreakdownRow {
+	viewCounts := make(map[string]int)
+	sessionSets := make(map[string]map[string]bool)
+
+	for _, pv := range pageViews {
+		value := key(pv)
+		if value == "" {
+			continue
+		}
+		viewCounts[value]++
+		if sessionSets[value] == nil {
+			sessionSets[value] = make(map[string]bool)
+		}
+		if pv.SessionID != "" {
+			sessionSets[value][pv.SessionID] = true
+		}
+	}
+
+	rows := []BreakdownRow{}
+	for value, count := range viewCounts {
+		rows = append(rows, BreakdownRow{Name: value, Views: count, Sessions: len(sessionSets[value])})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Views != rows[j].Views {
+			return rows[i].Views > rows[j].Views
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
 }
 
 // analyticsScriptHandler serves the dynamic JavaScript tracking file.
@@ -432,16 +911,85 @@ func analyticsScriptHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	// Use the ID of the first website in the configuration
 	trackingID := websites[0].ID
+	respectDNT := "false"
+	if websites[0].RespectDNT {
+		respectDNT = "true"
+	}
+	consentMode := websites[0].ConsentMode
+	if consentMode != consentRequired && consentMode != consentAnonymous {
+		consentMode = ""
+	}
 
 	// The tracking script, with a placeholder for the tracking ID
 	scriptContent := `(function() {
+    // Capture the script tag now; document.currentScript is null once init() runs
+    const script = document.currentScript;
+
     const Analytics = {
         endpoint: '{{ANALYTICS_ORIGIN}}/track',
         trackingId: '{{TRACKING_ID}}', // This will be replaced by the server
+        respectDnt: {{RESPECT_DNT}}, // Whether this website honors DNT/GPC signals
+        consentMode: '{{CONSENT_MODE}}', // '' (no gate), 'required' or 'anonymous'
+        ready: false, // Set once the DOM is loaded and init() has run
+        tracked: false, // Set once this page view has been sent
+        userId: null, // Stable user ID from identify() or <script data-user-id="...">
         
         init() {
-            this.sessionId = this.getSessionId();
-            this.trackPageView();
+            this.ready = true;
+            this.userId = this.userId || (script && script.getAttribute('data-user-id')) ||
+                sessionStorage.getItem('analytics_user');
+            // Visitors who opted out only send an empty ping so the opt-out rate can be reported
+            if (this.respectDnt && this.hasOptOutSignal()) {
+                this.tracked = true;
+                this.send({ tracking_id: this.trackingId, opt_out: true });
+                return;
+            }
+            if (!this.consentMode || this.hasConsent()) {
+                this.trackPageView();
+            } else if (this.consentMode === 'anonymous') {
+                // Aggregate-only hit: no session ID and nothing written to storage
+                this.trackPageView(true);
+            }
+        },
+        
+        // Called by the page (or its consent banner) once the visitor has decided.
+        // Consent is remembered for the browser session so later pages track straight away.
+        consent(granted) {
+            if (!this.consentMode) {
+                return;
+            }
+            if (!granted) {
+                sessionStorage.removeItem('analytics_consent');
+                return;
+            }
+            sessionStorage.setItem('analytics_consent', '1');
+            if (this.ready && !this.tracked) {
+                this.trackPageView();
+            }
+        },
+        
+        // Attaches a stable ID for a signed-in user to later hits, e.g. Analytics.identify(account.id)
+        // Pass an opaque ID, not an email; identify(null) clears it on sign-out.
+        // The ID is only remembered for the browser session when storage is allowed.
+        identify(id) {
+            this.userId = id ? String(id) : null;
+            if (this.consentMode && !this.hasConsent()) {
+                return;
+            }
+            if (this.userId) {
+                sessionStorage.setItem('analytics_user', this.userId);
+            } else {
+                sessionStorage.removeItem('analytics_user');
+            }
+        },
+        
+        hasConsent() {
+            return sessionStorage.getItem('analytics_consent') === '1';
+        },
+        
+        hasOptOutSignal() {
+            const dnt = navigator.doNotTrack || window.doNotTrack || navigator.msDoNotTrack;
+            return dnt === '1' || dnt === 'yes' || navigator.globalPrivacyControl === true;
         },
         
         getSessionId() {
@@ -453,17 +1001,62 @@ func analyticsScriptHandler(w http.ResponseWriter, r *http.Request) {
             return sessionId;
         },
         
-        trackPageView() {
+        // A page can flag itself as "not found" with <script data-404 ...>
+        // or <meta name="analytics-404" content="true">
+        isNotFoundPage() {
+            if (script && script.hasAttribute('data-404')) {
+                return true;
+            }
+            const meta = document.querySelector('meta[name="analytics-404"]');
+            return !!meta && meta.getAttribute('content') !== 'false';
+        },
+        
+        // Builds the fields shared by page views and custom events
+        payload(anonymous) {
             const data = {
                 tracking_id: this.trackingId,
-                session_id: this.sessionId,
+                session_id: anonymous ? '' : this.getSessionId(),
                 page_url: window.location.href,
                 page_title: document.title,
                 referrer: document.referrer,
                 user_agent: navigator.userAgent,
                 timestamp: new Date().toISOString()
             };
-            
+            if (this.consentMode) {
+                data.mode = anonymous ? 'anonymous' : 'consented';
+            }
+            if (this.userId && !anonymous) {
+                data.user_id = this.userId;
+            }
+            return data;
+        },
+        
+        trackPageView(anonymous) {
+            this.tracked = true;
+            const data = this.payload(anonymous);
+            if (this.isNotFoundPage()) {
+                data.event = '404';
+            }
+            this.send(data);
+        },
+        
+        // Records a custom event, e.g. Analytics.track('signup', { plan: 'pro' })
+        // Follows the same DNT and consent rules as page views
+        track(name, props) {
+            if (!name || (this.respectDnt && this.hasOptOutSignal())) {
+                return;
+            }
+            const consented = !this.consentMode || this.hasConsent();
+            if (!consented && this.consentMode !== 'anonymous') {
+                return;
+            }
+            const data = this.payload(!consented);
+            data.event = String(name);
+            data.props = props || {};
+            this.send(data);
+        },
+        
+        send(data) {
             // Use sendBeacon for reliable, asynchronous tracking
             if (navigator.sendBeacon) {
                 const blob = new Blob([JSON.stringify(data)], {
@@ -481,6 +1074,13 @@ func analyticsScriptHandler(w http.ResponseWriter, r *http.Request) {
         }
     };
     
+    // Expose the public API (Analytics.consent(true), Analytics.track(name, props), Analytics.identify(id)) to the page
+    window.Analytics = {
+        consent: (granted) => Analytics.consent(granted),
+        track: (name, props) => Analytics.track(name, props),
+        identify: (id) => Analytics.identify(id)
+    };
+    
     // Run analytics script after the DOM is loaded
     if (document.readyState === 'loading') {
         document.addEventListener('DOMContentLoaded', () => Analytics.init());
@@ -508,6 +1108,8 @@ func analyticsScriptHandler(w http.ResponseWriter, r *http.Request) {
 	// Replace the placeholders with actual values
 	finaScript := strings.Replace(scriptContent, "{{TRACKING_ID}}", trackingID, 1)
 	finaScript = strings.Replace(finaScript, "{{ANALYTICS_ORIGIN}}", analyticsOrigin, 1)
+	finaScript = strings.Replace(finaScript, "{{RESPECT_DNT}}", respectDNT, 1)
+	finaScript = strings.Replace(finaScript, "{{CONSENT_MODE}}", consentMode, 1)
 
 	// Serve the final script
 	w.Header().Set("Content-Type", "application/javascript")
@@ -580,11 +1182,58 @@ func testPage2Handler(w http.ResponseWriter, r *http.Request) {
 // main is the entry point of the application.
 // It sets up the server, routes, and middleware.
 func main() {
+	// Load encryption keys before any data file is read or written
+	if err := loadKeyring(); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
 	// Ensure the data directory and required files exist on startup
 	if err := ensureDataDir(); err != nil {
 		log.Fatalf("Failed to initialize data directory: %v", err)
 	}
 
+	// Run a maintenance command instead of the server if one was given
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
+	// Load the optional GeoIP database for country/region/city enrichment
+	if err := loadGeoIP(); err != nil {
+		log.Fatalf("Failed to load GeoIP database: %v", err)
+	}
+	if dataKeys != nil {
+		fmt.Println("🔐 Page view data is encrypted at rest")
+	}
+	// Refuse to start if stored data is encrypted with a key that is not configured
+	if err := checkEncryptedFiles(); err != nil {
+		log.Fatalf("Cannot read encrypted data: %v", err)
+	}
+	// Destroy a salt left over from an earlier day, then keep rotating it at every UTC midnight
+	if err := expireSalt(time.Now()); err != nil {
+		log.Printf("Error rotating daily salt: %v", err)
+	}
+	go rotateSaltDaily()
+	// Build unique count sketches for existing page views on the first start
+	if err := backfillSketches(); err != nil {
+		log.Printf("Error building unique count sketches (run rebuild-sketches): %v", err)
+	}
+	if geoDB != nil {
+		fmt.Printf("🌍 GeoIP enrichment enabled (%s)\n", os.Getenv("GEOIP_DB"))
+	}
+	if os.Getenv("USER_ID_SECRET") == "" {
+		fmt.Println("👤 USER_ID_SECRET is not set: user IDs from Analytics.identify will not be stored")
+	}
+	// Hashed IP mode without its secret stores no IPs at all, which is easy to miss
+	var websites []Website
+	if err := readJSONFile(websitesFile, &websites); err != nil {
+		log.Printf("Error reading websites: %v", err)
+	} else if ids := unhashedIPWebsites(websites); len(ids) > 0 {
+		fmt.Printf("🌐 IP_HASH_SECRET is not set: IP addresses will not be stored for %s (ip_mode \"hash\")\n", strings.Join(ids, ", "))
+	}
+
 	// Create a new Gorilla Mux router
 	// This router provides more advanced routing capabilities than the default http.ServeMux
 	r := mux.NewRouter()
@@ -594,7 +1243,18 @@ func main() {
 	r.HandleFunc("/", dashboardHandler).Methods("GET")
 	r.HandleFunc("/track", trackHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/stats/{trackingId}", statsHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/timeseries", timeseriesHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/entry-pages", entryPagesHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/exit-pages", exitPagesHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/funnels", funnelsHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/retention", retentionHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/paths", pathsHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/realtime", realtimeHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/live", liveStreamHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/uniques", uniquesHandler).Methods("GET")
+	r.HandleFunc("/stats/{trackingId}/breakdown", breakdownHandler).Methods("GET")
 	r.HandleFunc("/analytics.js", analyticsScriptHandler).Methods("GET")
+	r.HandleFunc("/admin/data-subject", dataSubjectHandler).Methods("GET", "DELETE")
 	r.HandleFunc("/test", testPageHandler).Methods("GET")
 	r.HandleFunc("/test2", testPage2Handler).Methods("GET")
 
@@ -611,7 +1271,7 @@ func main() {
 			} else {
 				w.Header().Set("Access-Control-Allow-Origin", "*")
 			}
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strconv"      // For formatting counts
+	"strings"      // For building long values
+	"testing"      // For the test runner
+	"unicode/utf8" // For checking truncated values
+)
+
+// =============================================================================
+// EVENT PROPERTY TESTS
+// =============================================================================
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxBytes int
+		want     string
+	}{
+		{name: "short text is unchanged", text: "pro", maxBytes: 5, want: "pro"},
+		{name: "exactly the limit", text: "abcde", maxBytes: 5, want: "abcde"},
+		{name: "ASCII is cut at the limit", text: "abcdef", maxBytes: 5, want: "abcde"},
+		// "é" is 2 bytes: byte 5 would split it
+		{name: "a two-byte character crossing the limit is dropped", text: "abcdé", maxBytes: 5, want: "abcd"},
+		{name: "a two-byte character ending at the limit is kept", text: "abcé!", maxBytes: 5, want: "abcé"},
+		// "€" is 3 bytes and "😀" is 4
+		{name: "three-byte characters", text: "€€€", maxBytes: 7, want: "€€"},
+		{name: "four-byte characters", text: "😀😀", maxBytes: 7, want: "😀"},
+		{name: "nothing fits", text: "😀", maxBytes: 3, want: ""},
+	}
+	for _, tt := range tests {
+		got := truncateText(tt.text, tt.maxBytes)
+		if got != tt.want {
+			t.Errorf("%s: truncateText(%q, %d) = %q, want %q", tt.name, tt.text, tt.maxBytes, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: truncateText returned invalid UTF-8 %q", tt.name, got)
+		}
+	}
+
+	// A property value at the real limit, with a character straddling it
+	long := strings.Repeat("a", maxPropValueLength-1) + "ü"
+	if got := truncateText(long, maxPropValueLength); len(got) != maxPropValueLength-1 || !utf8.ValidString(got) {
+		t.Errorf("truncated property value has %d bytes (valid UTF-8: %v), want %d", len(got), utf8.ValidString(got), maxPropValueLength-1)
+	}
+}
+
+// =============================================================================
+// BROKEN LINK TESTS
+// =============================================================================
+
+// brokenSummary flattens broken pages to "url views [referrer count ...]" entries
+func brokenSummary(pages []BrokenPage) string {
+	lines := make([]string, len(pages))
+	for i, page := range pages {
+		lines[i] = page.PageURL + " " + strconv.Itoa(page.Views) + " ["
+		for j, ref := range page.Referrers {
+			if j > 0 {
+				lines[i] += " "
+			}
+			lines[i] += ref.Referrer + " " + strconv.Itoa(ref.Count)
+		}
+		lines[i] += "]"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestBrokenPages(t *testing.T) {
+	notFound := func(url, referrer string) PageView {
+		return PageView{PageURL: url, Referrer: referrer, Event: eventNotFound}
+	}
+	pageViews := []PageView{
+		notFound("https://example.com/old-pricing", "https://blog.example.org/review"),
+		notFound("https://example.com/old-pricing", "https://news.example.net/"),
+		notFound("https://example.com/old-pricing", "https://blog.example.org/review"),
+		notFound("https://example.com/old-pricing", ""), // Typed in or bookmarked
+		notFound("https://example.com/typo", ""),
+		notFound("https://example.com/typo", ""),
+		notFound("https://example.com/gone", "https://example.com/"),
+		// Page views and other events on the same URLs are not broken links
+		{PageURL: "https://example.com/old-pricing", Referrer: "https://news.example.net/"},
+		{PageURL: "https://example.com/gone", Event: "signup"},
+	}
+
+	want := strings.Join([]string{
+		"https://example.com/old-pricing 4 [https://blog.example.org/review 2 https://news.example.net/ 1]",
+		"https://example.com/typo 2 []",
+		"https://example.com/gone 1 [https://example.com/ 1]",
+	}, "\n")
+	if got := brokenSummary(brokenPages(pageViews, 0)); got != want {
+		t.Errorf("brokenPages =\n%s\nwant\n%s", got, want)
+	}
+	if got := brokenSummary(brokenPages(pageViews, 2)); got != strings.Join(strings.Split(want, "\n")[:2], "\n") {
+		t.Errorf("brokenPages with limit 2 =\n%s", got)
+	}
+
+	// No 404s: an empty list, with referrers never null in the JSON
+	if pages := brokenPages(pageViews[7:], 10); pages == nil || len(pages) != 0 {
+		t.Errorf("brokenPages without 404s = %#v, want an empty list", pages)
+	}
+	if pages := brokenPages(pageViews[4:6], 0); pages[0].Referrers == nil {
+		t.Error("brokenPages returned nil referrers for direct hits")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json" // For encoding the response
+	"net/http"      // For the paths handler
+	"sort"          // For ordering branches
+	"strconv"       // For parsing the steps parameter
+)
+
+// =============================================================================
+// NAVIGATION PATHS
+// =============================================================================
+
+// maxPathSteps caps how many pages a path report follows from its start or end page
+const maxPathSteps = 5
+
+// Paths is the response of the /stats/{trackingId}/paths endpoint
+type Paths struct {
+	Range     DateRange `json:"range"`     // Reporting period
+	Direction string    `json:"direction"` // "next" (from the start page) or "previous" (leading to the end page)
+	Steps     int       `json:"steps"`     // Number of pages followed after (or before) the root
+	Root      PathNode  `json:"root"`      // The start or end page, with branches for each following (or preceding) page
+}
+
+// PathNode is one page in the path tree
+type PathNode struct {
+	Page     string     `json:"page"`               // Page path (the requested pattern for the root)
+	Sessions int        `json:"sessions"`           // Sessions that followed the path from the root to this page
+	Exits    int        `json:"exits"`              // Sessions whose path stops here (they left, or for "previous", arrived here first)
+	Children []PathNode `json:"children,omitempty"` // Most common next (or previous) pages, most sessions first
+}
+
+// pathTree accumulates sequences before they are converted to PathNodes
+type pathTree struct {
+	sessions int
+	exits    int
+	children map[string]*pathTree
+}
+
+// add records one session's sequence of pages below this node
+func (t *pathTree) add(pages []string, steps int) {
+	t.sessions++
+	if len(pages) == 0 {
+		if steps > 0 {
+			t.exits++
+		}
+		return
+	}
+	if t.children == nil {
+		t.children = make(map[string]*pathTree)
+	}
+	child := t.children[pages[0]]
+	if child == nil {
+		child = &pathTree{}
+		t.children[pages[0]] = child
+	}
+	child.add(pages[1:], steps-1)
+}
+
+// node converts the tree to a PathNode, keeping the most common branches at every level
+func (t *pathTree) node(page string, branches int) PathNode {
+	n := PathNode{Page: page, Sessions: t.sessions, Exits: t.exits}
+	for childPage, child := range t.children {
+		n.Children = append(n.Children, child.node(childPage, branches))
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Sessions != n.Children[j].Sessions {
+			return n.Children[i].Sessions > n.Children[j].Sessions
+		}
+		return n.Children[i].Page < n.Children[j].Page
+	})
+	if len(n.Children) > branches {
+		n.Children = n.Children[:branches]
+	}
+	return n
+}
+
+// sessionPages lists the paths a session visited, collapsing reloads of the same page
+func sessionPages(s session) []string {
+	var pages []string
+	for _, pv := range s.Views {
+		page := pagePath(pv.PageURL)
+		if len(pages) == 0 || pages[len(pages)-1] != page {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// buildPaths follows each session from the first page matching pattern for up to steps pages,
+// forwards or (with backward set) backwards, and merges the sequences into a tree
+func buildPaths(sessions []session, pattern string, backward bool, steps, branches int) PathNode {
+	root := &pathTree{}
+	target := compileWildcard(pattern)
+	for _, s := range sessions {
+		pages := sessionPages(s)
+		for i, page := range pages {
+			if !target.match(page) {
+				continue
+			}
+			var sequence []string
+			if backward {
+				for j := i - 1; j >= 0 && len(sequence) < steps; j-- {
+					sequence = append(sequence, pages[j])
+				}
+			} else {
+				for j := i + 1; j < len(pages) && len(sequence) < steps; j++ {
+					sequence = append(sequence, pages[j])
+				}
+			}
+			root.add(sequence, steps)
+			break // Only the first visit to the page counts
+		}
+	}
+	return root.node(pattern, branches)
+}
+
+// pathsHandler serves the most common navigation paths from a start page or to an end page
+// Parameters: start=<path> or end=<path> ("*" wildcards allowed), steps=1-5 (default 3),
+// limit=<branches per page> (default 5), plus the usual period and filter parameters
+func pathsHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	params := r.URL.Query()
+	start, end := params.Get("start"), params.Get("end")
+	if (start == "") == (end == "") {
+		writeQueryError(w, badQuery("give exactly one of start or end (a page path such as /pricing)"))
+		return
+	}
+	steps := 3
+	if value := params.Get("steps"); value != "" {
+		steps, err = strconv.Atoi(value)
+		if err != nil || steps < 1 || steps > maxPathSteps {
+			writeQueryError(w, badQuery("invalid steps %q: use a number from 1 to %d", value, maxPathSteps))
+			return
+		}
+	}
+	branches, err := parseLimit(r, 5)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	sessions, err := loadSessions(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	response := Paths{Range: query.dateRange(), Direction: "next", Steps: steps}
+	if end != "" {
+		response.Direction = "previous"
+		response.Root = buildPaths(sessions, end, true, steps, branches)
+	} else {
+		response.Root = buildPaths(sessions, start, false, steps, branches)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"     // For decoding handler responses
+	"net/http"          // For handler signatures and status codes
+	"net/http/httptest" // For recording handler responses
+	"path/filepath"     // For temporary data files
+	"strconv"           // For formatting counts
+	"strings"           // For comparing path trees
+	"testing"           // For the test runner
+	"time"              // For page view timestamps
+
+	"github.com/gorilla/mux" // For setting the trackingId route variable
+)
+
+// =============================================================================
+// TEST HELPERS
+// =============================================================================
+
+// useTestSite points the websites and page view files at a temporary directory holding the given data
+func useTestSite(t *testing.T, websites []Website, views []PageView) {
+	t.Helper()
+	useTempDataFiles(t)
+	useTestKeys(t)
+	previous := websitesFile
+	t.Cleanup(func() { websitesFile = previous })
+	websitesFile = filepath.Join(filepath.Dir(pageViewsFile), "websites.json")
+
+	if err := writeJSONFile(websitesFile, websites); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSONFile(pageViewsFile, views); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveStats calls a /stats/{trackingId} handler for a website with a query string
+func serveStats(handler http.HandlerFunc, trackingID, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/stats/"+trackingID+"?"+query, nil)
+	r = mux.SetURLVars(r, map[string]string{"trackingId": trackingID})
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// =============================================================================
+// NAVIGATION PATH TESTS
+// =============================================================================
+
+// pathTestSessions are the sessions the path tests follow
+var pathTestSessions = []session{
+	testSession("a", funnelStep{0, "/", ""}, funnelStep{1, "/pricing", ""}, funnelStep{2, "/signup", ""}, funnelStep{3, "/done", ""}),
+	testSession("b", funnelStep{0, "/", ""}, funnelStep{1, "/pricing", ""}, funnelStep{2, "/", ""}),
+	testSession("c", funnelStep{0, "/", ""}, funnelStep{1, "/blog/", ""}),
+	testSession("d", funnelStep{0, "/blog/", ""}, funnelStep{1, "/", ""}, funnelStep{2, "/pricing", ""}),
+	testSession("e", funnelStep{0, "/pricing", ""}),
+	// A reload of / collapses into one step; the later return to / is part of the path
+	testSession("f", funnelStep{0, "/", ""}, funnelStep{1, "/", ""}, funnelStep{2, "/pricing", ""}, funnelStep{3, "/", ""}, funnelStep{4, "/docs", ""}),
+}
+
+// pathSummary flattens a path tree to "page sessions/exits" entries, depth first
+func pathSummary(n PathNode) []string {
+	out := []string{n.Page + " " + strconv.Itoa(n.Sessions) + "/" + strconv.Itoa(n.Exits)}
+	for _, child := range n.Children {
+		for _, line := range pathSummary(child) {
+			out = append(out, "  "+line)
+		}
+	}
+	return out
+}
+
+func TestBuildPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		backward bool
+		steps    int
+		branches int
+		want     []string
+	}{
+		{name: "forward from the start page", pattern: "/", steps: 2, branches: 5, want: []string{
+			"/ 5/0",
+			"  /pricing 4/1", // d stops after /pricing
+			"    / 2/0",      // b and f return to / (f's reload of / is not a step)
+			"    /signup 1/0",
+			"  /blog/ 1/1",
+		}},
+		{name: "one step", pattern: "/", steps: 1, branches: 5, want: []string{
+			"/ 5/0",
+			"  /pricing 4/0", // The path is cut off, not left
+			"  /blog/ 1/0",
+		}},
+		{name: "branches keep the most common pages", pattern: "/", steps: 2, branches: 1, want: []string{
+			"/ 5/0",
+			"  /pricing 4/1",
+			"    / 2/0",
+		}},
+		{name: "backward from the end page", pattern: "/signup", backward: true, steps: 3, branches: 5, want: []string{
+			"/signup 1/0",
+			"  /pricing 1/0",
+			"    / 1/1", // The session arrived on /
+		}},
+		// Sessions that start on the end page have nothing before it; the first visit counts
+		{name: "backward from a landing page", pattern: "/", backward: true, steps: 2, branches: 5, want: []string{
+			"/ 5/4",
+			"  /blog/ 1/1",
+		}},
+		{name: "wildcard start page", pattern: "/blog*", steps: 3, branches: 5, want: []string{
+			"/blog* 2/1", // c leaves from /blog/
+			"  / 1/0",
+			"    /pricing 1/1",
+		}},
+		{name: "no session visits the page", pattern: "/nowhere", steps: 3, branches: 5, want: []string{
+			"/nowhere 0/0",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pathSummary(buildPaths(pathTestSessions, tt.pattern, tt.backward, tt.steps, tt.branches))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("buildPaths =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestPathsHandler(t *testing.T) {
+	now := time.Now().UTC()
+	var views []PageView
+	for _, s := range pathTestSessions {
+		for i, pv := range s.Views {
+			pv.WebsiteID = "site"
+			pv.Timestamp = now.Add(time.Duration(i-10) * time.Minute)
+			views = append(views, pv)
+		}
+	}
+	useTestSite(t, []Website{{ID: "site", Domain: "example.com"}}, views)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{query: "start=/", wantStatus: http.StatusOK},
+		{query: "end=/signup&steps=5&limit=1000", wantStatus: http.StatusOK},
+		{query: "", wantStatus: http.StatusBadRequest},
+		{query: "start=/&end=/signup", wantStatus: http.StatusBadRequest},
+		{query: "start=/&steps=0", wantStatus: http.StatusBadRequest},
+		{query: "start=/&steps=6", wantStatus: http.StatusBadRequest},
+		{query: "start=/&steps=two", wantStatus: http.StatusBadRequest},
+		{query: "start=/&limit=0", wantStatus: http.StatusBadRequest},
+		{query: "start=/&limit=1001", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serveStats(pathsHandler, "site", tt.query); w.Code != tt.wantStatus {
+			t.Errorf("paths?%s: status %d, want %d (%s)", tt.query, w.Code, tt.wantStatus, w.Body.String())
+		}
+	}
+
+	// Defaults: three steps forward, five branches per page
+	w := serveStats(pathsHandler, "site", "start=/")
+	var paths Paths
+	if err := json.Unmarshal(w.Body.Bytes(), &paths); err != nil {
+		t.Fatal(err)
+	}
+	if paths.Direction != "next" || paths.Steps != 3 || paths.Root.Sessions != 5 || len(paths.Root.Children) != 2 {
+		t.Errorf("paths?start=/ = %+v", paths)
+	}
+
+	w = serveStats(pathsHandler, "site", "end=/signup&steps=1")
+	json.Unmarshal(w.Body.Bytes(), &paths)
+	if paths.Direction != "previous" || paths.Steps != 1 || paths.Root.Sessions != 1 {
+		t.Errorf("paths?end=/signup = %+v", paths)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/hmac"   // For keyed IP and user ID hashing
+	"crypto/rand"   // For generating salts
+	"crypto/sha256" // For hashing visitor identifiers
+	"encoding/hex"  // For encoding salts and hashes
+	"errors"        // For detecting a missing salt file
+	"fmt"           // For error formatting
+	"log"           // For logging salt rotation failures
+	"net"           // For parsing and masking IP addresses
+	"net/http"      // For reading privacy request headers
+	"os"            // For checking the salt file and reading the hashing secrets
+	"path/filepath" // For building the salt file path
+	"sync"          // For guarding the current salt
+	"time"          // For detecting day changes and scheduling salt rotation
+)
+
+// =============================================================================
+// VISITOR IDENTIFICATION
+// =============================================================================
+
+// dailySalt is the random value mixed into visitor hashes for a single UTC day
+// Once the day ends it is overwritten, so yesterday's visitor IDs can never be recomputed
+type dailySalt struct {
+	Date string `json:"date"` // UTC day the salt is valid for (YYYY-MM-DD)
+	Salt string `json:"salt"` // Hex-encoded random salt
+}
+
+var (
+	// saltFile persists today's salt so a restart does not split visitors in two
+	// It is only readable by the owner and is encrypted when a data key is configured
+	saltFile = filepath.Join(dataDir, "salt.json")
+
+	// privateFiles are written with owner-only permissions because they hold secrets
+	privateFiles = []string{saltFile}
+
+	// currentSalt is today's salt; saltMutex guards rotation
+	currentSalt dailySalt
+	saltMutex   sync.Mutex
+)
+
+// todaysSalt returns the salt for the current UTC day, rotating it if the day has changed
+func todaysSalt() (string, error) {
+	saltMutex.Lock()
+	defer saltMutex.Unlock()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	if currentSalt.Date == today {
+		return currentSalt.Salt, nil
+	}
+
+	// Reuse the persisted salt if the server restarted earlier today
+	var stored dailySalt
+	if _, err := os.Stat(saltFile); err == nil {
+		if err := readJSONFile(saltFile, &stored); err == nil && stored.Date == today {
+			currentSalt = stored
+			return currentSalt.Salt, nil
+		}
+	}
+
+	// Generate a fresh salt; writing it replaces (and so destroys) the previous day's salt
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	fresh := dailySalt{Date: today, Salt: hex.EncodeToString(buf)}
+	if err := writeJSONFile(saltFile, fresh); err != nil {
+		return "", fmt.Errorf("failed to save salt: %w", err)
+	}
+	currentSalt = fresh
+	return currentSalt.Salt, nil
+}
+
+// expireSalt forgets the salt, in memory and on disk, unless it is for the current UTC day
+// Hits only rotate the salt when they arrive, so without this a quiet site would keep yesterday's
+// salt (and with it the ability to recompute yesterday's visitor IDs) until its next hit.
+func expireSalt(now time.Time) error {
+	saltMutex.Lock()
+	defer saltMutex.Unlock()
+
+	today := now.UTC().Format("2006-01-02")
+	if currentSalt.Date != today {
+		currentSalt = dailySalt{}
+	}
+	var stored dailySalt
+	err := readJSONFile(saltFile, &stored)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err == nil && stored.Date == today {
+		// Rewrite it so a salt saved before encryption or owner-only permissions were configured gets both
+		return writeJSONFile(saltFile, stored)
+	}
+	// A stale or unreadable salt is useless for today; todaysSalt generates a new one on the next hit
+	if err := os.Remove(saltFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove expired salt: %w", err)
+	}
+	return nil
+}
+
+// rotateSaltDaily expires the salt at every UTC midnight; it runs for the life of the server
+func rotateSaltDaily() {
+	for {
+		now := time.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		time.Sleep(time.Until(midnight))
+		if err := expireSalt(time.Now()); err != nil {
+			log.Printf("Error rotating daily salt: %v", err)
+		}
+	}
+}
+
+// visitorID derives a cookieless visitor identifier from today's salt, the website, IP and user agent
+// The same browser gets the same ID across tabs for one day, but IDs cannot be linked across days or sites
+func visitorID(websiteID, ip, userAgent string) (string, error) {
+	salt, err := todaysSalt()
+	if err != nil {
+		return "", err
+	}
+	// Separate fields with a NUL byte so ("ab", "c") and ("a", "bc") hash differently
+	hash := sha256.Sum256([]byte(salt + "\x00" + websiteID + "\x00" + ip + "\x00" + userAgent))
+	return hex.EncodeToString(hash[:16]), nil
+}
+
+// userHash pseudonymizes a user ID supplied by the website so raw account IDs or emails are never stored
+// It is an HMAC keyed with USER_ID_SECRET, so guessable IDs (numbers, emails) cannot be recovered by
+// hashing candidates. The website ID is mixed in so the same user cannot be linked across websites.
+// Without USER_ID_SECRET the result is empty and user IDs are not stored.
+func userHash(websiteID, userID string) string {
+	secret := os.Getenv("USER_ID_SECRET")
+	if userID == "" || secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(websiteID + "\x00" + userID))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// =============================================================================
+// IP ADDRESS HANDLING
+// =============================================================================
+
+// IP handling modes for Website.IPMode
+const (
+	ipModeFull     = "full"     // Store the address as received
+	ipModeTruncate = "truncate" // Zero the host part: /24 for IPv4, /48 for IPv6
+	ipModeHash     = "hash"     // Store an HMAC of the address keyed with IP_HASH_SECRET
+	ipModeDrop     = "drop"     // Store nothing (the default)
+)
+
+// validIPModes lists the accepted Website.IPMode values
+var validIPModes = map[string]bool{ipModeFull: true, ipModeTruncate: true, ipModeHash: true, ipModeDrop: true}
+
+// ipMode returns the website's IP handling mode, defaulting to drop
+func ipMode(website Website) string {
+	if website.IPMode == "" {
+		return ipModeDrop
+	}
+	return website.IPMode
+}
+
+// anonymizeIP applies an IP handling mode to an address and returns the value to store
+// Hash mode falls back to dropping the address when IP_HASH_SECRET is not set
+func anonymizeIP(ip, mode string) string {
+	switch mode {
+	case ipModeFull:
+		return ip
+	case ipModeTruncate:
+		return truncateIP(ip)
+	case ipModeHash:
+		secret := os.Getenv("IP_HASH_SECRET")
+		if secret == "" || ip == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	default:
+		return ""
+	}
+}
+
+// unhashedIPWebsites lists the websites using ip_mode "hash" while IP_HASH_SECRET is not set
+// Their IPs are silently dropped, so the server warns about them at startup
+func unhashedIPWebsites(websites []Website) []string {
+	if os.Getenv("IP_HASH_SECRET") != "" {
+		return nil
+	}
+	var ids []string
+	for _, website := range websites {
+		if ipMode(website) == ipModeHash {
+			ids = append(ids, website.ID)
+		}
+	}
+	return ids
+}
+
+// truncateIP zeroes the host bits of an address, keeping the /24 (IPv4) or /48 (IPv6) network
+// Values that are not IP addresses (e.g., already hashed) are returned unchanged
+func truncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// =============================================================================
+// DO NOT TRACK / GLOBAL PRIVACY CONTROL
+// =============================================================================
+
+// optOutsFile stores daily counts of hits suppressed by DNT/GPC, keyed by website ID then UTC day
+// Only the count is kept; nothing else about a suppressed hit is stored
+var optOutsFile = filepath.Join(dataDir, "optouts.json")
+
+// hasOptOutSignal reports whether the request carries a Do Not Track or Global Privacy Control signal
+func hasOptOutSignal(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
+}
+
+// readOptOuts loads the suppressed hit counts, treating a missing file as empty
+func readOptOuts() (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+	if _, err := os.Stat(optOutsFile); os.IsNotExist(err) {
+		return counts, nil
+	}
+	if err := readJSONFile(optOutsFile, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// recordOptOut increments the suppressed hit count for a website on the given day
+// The file is read and written under one lock so simultaneous opt-outs do not lose each other's increments
+func recordOptOut(websiteID string, t time.Time) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var counts map[string]map[string]int
+	if err := readJSONData(optOutsFile, &counts); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if counts == nil {
+		counts = make(map[string]map[string]int)
+	}
+	if counts[websiteID] == nil {
+		counts[websiteID] = make(map[string]int)
+	}
+	counts[websiteID][t.UTC().Format("2006-01-02")]++
+	return writeJSONData(optOutsFile, counts)
+}
+
+// countOptOuts totals the suppressed hits for a website on the UTC days overlapping [start, end)
+func countOptOuts(websiteID string, start, end time.Time) (int, error) {
+	counts, err := readOptOuts()
+	if err != nil {
+		return 0, err
+	}
+	startDay := start.UTC().Format("2006-01-02")
+	endDay := end.Add(-time.Nanosecond).UTC().Format("2006-01-02")
+	total := 0
+	for day, count := range counts[websiteID] {
+		// ISO dates compare correctly as strings
+		if day >= startDay && day <= endDay {
+			total += count
+		}
+	}
+	return total, nil
+}
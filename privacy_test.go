@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto/rand"       // For generating test keys
+	"encoding/base64"   // For passing test keys through DATA_KEY
+	"net/http/httptest" // For requests with opt-out headers
+	"os"                // For inspecting the salt file
+	"path/filepath"     // For temporary salt paths
+	"strings"           // For building DATA_KEY
+	"sync"              // For simultaneous opt-outs
+	"testing"           // For the test runner
+	"time"              // For simulating day changes
+)
+
+// =============================================================================
+// TEST HELPERS
+// =============================================================================
+
+// useTestKeys configures DATA_KEY with the given keys (the first is the primary) for one test
+// With no keys, encryption is disabled
+func useTestKeys(t *testing.T, keys ...[]byte) {
+	t.Helper()
+	previous := dataKeys
+	t.Cleanup(func() { dataKeys = previous })
+
+	dataKeys = nil
+	encoded := make([]string, len(keys))
+	for i, key := range keys {
+		encoded[i] = base64.StdEncoding.EncodeToString(key)
+	}
+	t.Setenv("DATA_KEY_FILE", "")
+	t.Setenv("DATA_KEY", strings.Join(encoded, ","))
+	if err := loadKeyring(); err != nil {
+		t.Fatalf("loadKeyring: %v", err)
+	}
+}
+
+// newTestKey returns a random 32-byte key
+func newTestKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// useTempSalt points the salt file at a temporary directory and forgets the in-memory salt for one test
+func useTempSalt(t *testing.T) {
+	t.Helper()
+	previousFile, previousSalt := saltFile, currentSalt
+	previousPrivate, previousEncrypted := privateFiles, encryptedFiles
+	t.Cleanup(func() {
+		saltFile, currentSalt = previousFile, previousSalt
+		privateFiles, encryptedFiles = previousPrivate, previousEncrypted
+	})
+
+	saltFile = filepath.Join(t.TempDir(), "salt.json")
+	currentSalt = dailySalt{}
+	// The file lists hold the path they were initialized with
+	privateFiles = []string{saltFile}
+	encryptedFiles = []string{pageViewsFile, saltFile}
+}
+
+// =============================================================================
+// DAILY SALT TESTS
+// =============================================================================
+
+func TestTodaysSalt(t *testing.T) {
+	useTempSalt(t)
+	useTestKeys(t)
+
+	salt, err := todaysSalt()
+	if err != nil {
+		t.Fatalf("todaysSalt: %v", err)
+	}
+	if len(salt) != 64 {
+		t.Errorf("salt %q is not 32 hex-encoded bytes", salt)
+	}
+	again, err := todaysSalt()
+	if err != nil || again != salt {
+		t.Errorf("second todaysSalt = %q, %v; want the same salt", again, err)
+	}
+
+	// A restart later the same day reuses the persisted salt
+	currentSalt = dailySalt{}
+	if restarted, err := todaysSalt(); err != nil || restarted != salt {
+		t.Errorf("todaysSalt after restart = %q, %v; want the persisted salt", restarted, err)
+	}
+
+	info, err := os.Stat(saltFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("salt file mode = %o, want 600", mode)
+	}
+
+	// A salt from an earlier day is replaced rather than reused
+	writeJSONFile(saltFile, dailySalt{Date: "2000-01-01", Salt: "old"})
+	currentSalt = dailySalt{}
+	if fresh, err := todaysSalt(); err != nil || fresh == "old" || fresh == salt {
+		t.Errorf("todaysSalt with a stale file = %q, %v; want a new salt", fresh, err)
+	}
+}
+
+func TestExpireSalt(t *testing.T) {
+	useTempSalt(t)
+	useTestKeys(t)
+
+	salt, err := todaysSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expiring on the same day keeps the salt
+	if err := expireSalt(time.Now()); err != nil {
+		t.Fatalf("expireSalt today: %v", err)
+	}
+	if currentSalt.Salt != salt {
+		t.Error("expireSalt on the same day forgot the in-memory salt")
+	}
+	if _, err := os.Stat(saltFile); err != nil {
+		t.Errorf("expireSalt on the same day removed the salt file: %v", err)
+	}
+
+	// The next day both copies are destroyed, even though no hit arrived
+	if err := expireSalt(time.Now().Add(24 * time.Hour)); err != nil {
+		t.Fatalf("expireSalt tomorrow: %v", err)
+	}
+	if currentSalt.Salt != "" {
+		t.Error("expireSalt on the next day kept the in-memory salt")
+	}
+	if _, err := os.Stat(saltFile); !os.IsNotExist(err) {
+		t.Errorf("expireSalt on the next day kept the salt file: %v", err)
+	}
+
+	// Nothing to expire is not an error
+	if err := expireSalt(time.Now()); err != nil {
+		t.Errorf("expireSalt without a salt file: %v", err)
+	}
+}
+
+func TestExpireSaltRewritesLegacyFile(t *testing.T) {
+	useTempSalt(t)
+	useTestKeys(t, newTestKey(t))
+
+	// A plaintext, world-readable salt written before encryption was configured
+	today := time.Now().UTC().Format("2006-01-02")
+	legacy := []byte(`{"date":"` + today + `","salt":"legacy"}`)
+	if err := os.WriteFile(saltFile, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := expireSalt(time.Now()); err != nil {
+		t.Fatalf("expireSalt: %v", err)
+	}
+	data, err := os.ReadFile(saltFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(data) {
+		t.Error("salt file was not encrypted")
+	}
+	info, _ := os.Stat(saltFile)
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("salt file mode = %o, want 600", mode)
+	}
+	if salt, err := todaysSalt(); err != nil || salt != "legacy" {
+		t.Errorf("todaysSalt = %q, %v; want the rewritten salt", salt, err)
+	}
+}
+
+// =============================================================================
+// USER ID TESTS
+// =============================================================================
+
+func TestUserHash(t *testing.T) {
+	t.Setenv("USER_ID_SECRET", "")
+	if got := userHash("site-1", "user-42"); got != "" {
+		t.Errorf("userHash without a secret = %q, want empty (user IDs are not stored)", got)
+	}
+
+	t.Setenv("USER_ID_SECRET", "test secret")
+	// HMAC-SHA256("test secret", "site-1\x00user-42"), first 16 bytes
+	const want = "162dc3226d24ba318d59f363212416db"
+	if got := userHash("site-1", "user-42"); got != want {
+		t.Errorf("userHash = %q, want %q", got, want)
+	}
+	if got := userHash("site-1", ""); got != "" {
+		t.Errorf("userHash of an empty ID = %q, want empty", got)
+	}
+	// The same user on another website cannot be linked
+	if got := userHash("site-2", "user-42"); got == want {
+		t.Error("the same user hashed to the same value on two websites")
+	}
+	// The separator keeps the website and user IDs apart
+	if userHash("site-1u", "ser-42") == userHash("site-1", "user-42") {
+		t.Error("different website and user ID pairs hashed to the same value")
+	}
+
+	t.Setenv("USER_ID_SECRET", "another secret")
+	if got := userHash("site-1", "user-42"); got == want {
+		t.Error("hash did not change with the secret")
+	}
+}
+
+// =============================================================================
+// IP ADDRESS HANDLING TESTS
+// =============================================================================
+
+func TestTruncateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "203.0.113.77", want: "203.0.113.0"},
+		{ip: "203.0.113.0", want: "203.0.113.0"},
+		{ip: "10.1.2.255", want: "10.1.2.0"},
+		{ip: "::ffff:203.0.113.77", want: "203.0.113.0"}, // IPv4-mapped addresses are truncated as IPv4
+		{ip: "2001:db8:1234:5678:9abc::1", want: "2001:db8:1234::"},
+		{ip: "2001:db8:1234::", want: "2001:db8:1234::"},
+		{ip: "::1", want: "::"},
+		{ip: "", want: ""},
+		{ip: "3f2a9c0e7b1d4f6a", want: "3f2a9c0e7b1d4f6a"}, // Not an address, e.g. already hashed
+	}
+	for _, tt := range tests {
+		if got := truncateIP(tt.ip); got != tt.want {
+			t.Errorf("truncateIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	const ip = "203.0.113.77"
+
+	t.Run("without secret", func(t *testing.T) {
+		t.Setenv("IP_HASH_SECRET", "")
+		tests := []struct {
+			mode string
+			want string
+		}{
+			{mode: ipModeFull, want: ip},
+			{mode: ipModeTruncate, want: "203.0.113.0"},
+			{mode: ipModeHash, want: ""}, // Hashing without a secret would be reversible, so nothing is stored
+			{mode: ipModeDrop, want: ""},
+			{mode: "", want: ""},
+			{mode: "unknown", want: ""},
+		}
+		for _, tt := range tests {
+			if got := anonymizeIP(ip, tt.mode); got != tt.want {
+				t.Errorf("anonymizeIP(%q, %q) = %q, want %q", ip, tt.mode, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		t.Setenv("IP_HASH_SECRET", "first secret")
+		hashed := anonymizeIP(ip, ipModeHash)
+		if len(hashed) != 32 || hashed == ip {
+			t.Fatalf("anonymizeIP hash = %q, want 16 hex-encoded bytes", hashed)
+		}
+		if again := anonymizeIP(ip, ipModeHash); again != hashed {
+			t.Errorf("hash is not stable: %q then %q", hashed, again)
+		}
+		if other := anonymizeIP("203.0.113.78", ipModeHash); other == hashed {
+			t.Error("different addresses hashed to the same value")
+		}
+		if empty := anonymizeIP("", ipModeHash); empty != "" {
+			t.Errorf("anonymizeIP of an empty address = %q, want empty", empty)
+		}
+
+		t.Setenv("IP_HASH_SECRET", "second secret")
+		if rekeyed := anonymizeIP(ip, ipModeHash); rekeyed == hashed {
+			t.Error("hash did not change with the secret")
+		}
+	})
+}
+
+func TestIPMode(t *testing.T) {
+	if got := ipMode(Website{}); got != ipModeDrop {
+		t.Errorf("default ipMode = %q, want %q", got, ipModeDrop)
+	}
+	if got := ipMode(Website{IPMode: ipModeTruncate}); got != ipModeTruncate {
+		t.Errorf("ipMode = %q, want %q", got, ipModeTruncate)
+	}
+}
+
+func TestUnhashedIPWebsites(t *testing.T) {
+	websites := []Website{
+		{ID: "hashed", IPMode: ipModeHash},
+		{ID: "full", IPMode: ipModeFull},
+		{ID: "default"},
+		{ID: "also-hashed", IPMode: ipModeHash},
+	}
+	t.Setenv("IP_HASH_SECRET", "")
+	if got := strings.Join(unhashedIPWebsites(websites), ","); got != "hashed,also-hashed" {
+		t.Errorf("without IP_HASH_SECRET: %q, want hashed,also-hashed", got)
+	}
+	t.Setenv("IP_HASH_SECRET", "secret")
+	if got := unhashedIPWebsites(websites); len(got) != 0 {
+		t.Errorf("with IP_HASH_SECRET: %q, want none", got)
+	}
+}
+
+// =============================================================================
+// DO NOT TRACK / GLOBAL PRIVACY CONTROL TESTS
+// =============================================================================
+
+// useTempOptOuts points the opt-out counts at a temporary file for one test
+func useTempOptOuts(t *testing.T) {
+	t.Helper()
+	previous := optOutsFile
+	t.Cleanup(func() { optOutsFile = previous })
+	optOutsFile = filepath.Join(t.TempDir(), "optouts.json")
+}
+
+func TestHasOptOutSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "no signal", want: false},
+		{name: "DNT", headers: map[string]string{"DNT": "1"}, want: true},
+		{name: "DNT disabled", headers: map[string]string{"DNT": "0"}, want: false},
+		{name: "GPC", headers: map[string]string{"Sec-GPC": "1"}, want: true},
+		{name: "GPC with another value", headers: map[string]string{"Sec-GPC": "0"}, want: false},
+		{name: "both", headers: map[string]string{"DNT": "1", "Sec-GPC": "1"}, want: true},
+		{name: "header names are case-insensitive", headers: map[string]string{"dnt": "1"}, want: true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/track", nil)
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+		if got := hasOptOutSignal(r); got != tt.want {
+			t.Errorf("%s: hasOptOutSignal = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordOptOutConcurrently(t *testing.T) {
+	useTempOptOuts(t)
+	useTestKeys(t)
+	now := time.Now()
+
+	// Every increment survives, even when the hits arrive at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := recordOptOut("site", now); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, err := countOptOuts("site", now.Add(-time.Hour), now.Add(time.Hour)); err != nil || got != 50 {
+		t.Errorf("countOptOuts after 50 opt-outs = %d, %v; want 50", got, err)
+	}
+}
+
+func TestCountOptOuts(t *testing.T) {
+	useTempOptOuts(t)
+	useTestKeys(t)
+
+	// Nothing recorded yet: no file is not an error
+	if got, err := countOptOuts("site", time.Now().Add(-time.Hour), time.Now()); err != nil || got != 0 {
+		t.Errorf("countOptOuts without a file = %d, %v; want 0", got, err)
+	}
+
+	// Days are UTC: 23:30 in New York on the 9th is already the 10th
+	newYork := mustLocation(t, "America/New_York")
+	hits := []struct {
+		website string
+		at      time.Time
+	}{
+		{website: "site", at: at(t, "2026-03-09 12:00", time.UTC)},
+		{website: "site", at: at(t, "2026-03-09 23:30", newYork)},
+		{website: "site", at: at(t, "2026-03-10 00:00", time.UTC)},
+		{website: "site", at: at(t, "2026-03-11 23:59", time.UTC)},
+		{website: "other", at: at(t, "2026-03-10 12:00", time.UTC)},
+	}
+	for _, hit := range hits {
+		if err := recordOptOut(hit.website, hit.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		want       int
+	}{
+		{name: "one whole day", start: "2026-03-10 00:00", end: "2026-03-11 00:00", want: 2},
+		{name: "the end is exclusive", start: "2026-03-09 00:00", end: "2026-03-10 00:00", want: 1},
+		{name: "a range ending mid-day includes that day", start: "2026-03-09 00:00", end: "2026-03-10 00:01", want: 3},
+		{name: "a range starting mid-day includes that day", start: "2026-03-11 23:00", end: "2026-03-12 00:00", want: 1},
+		{name: "every day", start: "2026-03-01 00:00", end: "2026-04-01 00:00", want: 4},
+		{name: "no days recorded", start: "2026-03-12 00:00", end: "2026-03-20 00:00", want: 0},
+	}
+	for _, tt := range tests {
+		got, err := countOptOuts("site", at(t, tt.start, time.UTC), at(t, tt.end, time.UTC))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: countOptOuts = %d, %v; want %d", tt.name, got, err, tt.want)
+		}
+	}
+
+	if got, _ := countOptOuts("unknown", at(t, "2026-03-01 00:00", time.UTC), at(t, "2026-04-01 00:00", time.UTC)); got != 0 {
+		t.Errorf("countOptOuts for a website without opt-outs = %d, want 0", got)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json" // For encoding responses and stream events
+	"fmt"           // For writing Server-Sent Events
+	"net/http"      // For the realtime handlers
+	"sort"          // For ordering current pages
+	"sync"          // For guarding the subscriber list
+	"time"          // For the activity window and keep-alives
+)
+
+// =============================================================================
+// REALTIME
+// =============================================================================
+
+// realtimeWindow is how recently a visitor must have been seen to count as current
+const realtimeWindow = 5 * time.Minute
+
+// maxLiveSubscribers caps open stream connections so idle dashboards cannot exhaust the server
+const maxLiveSubscribers = 100
+
+// liveKeepAlive is how often an idle stream sends a comment so proxies do not close it
+const liveKeepAlive = 25 * time.Second
+
+// Realtime is the response of the /stats/{trackingId}/realtime endpoint
+type Realtime struct {
+	Visitors  int            `json:"visitors"`  // Visitors active in the last 5 minutes
+	Pages     []RealtimePage `json:"pages"`     // The page each active visitor viewed last, most visitors first
+	Referrers []ReferrerRow  `json:"referrers"` // External referrers of the last 5 minutes' page views
+}
+
+// RealtimePage counts the active visitors currently on a page
+type RealtimePage struct {
+	Page     string `json:"page"`     // Page path
+	Visitors int    `json:"visitors"` // Active visitors whose latest page view was this page
+}
+
+// LiveEvent is the sanitized form of a page view pushed to stream subscribers
+// It carries no identifiers (session, visitor, user, IP or user agent), query strings or event properties,
+// and the title is redacted with the website's scrubbing rules like stored URLs are
+type LiveEvent struct {
+	Page      string    `json:"page"`              // Page path
+	Title     string    `json:"title"`             // Page title, scrubbed
+	Source    string    `json:"source,omitempty"`  // Referrer source (e.g. "Google"), empty for direct traffic
+	Event     string    `json:"event,omitempty"`   // "404" or a custom event name; empty for page views
+	Browser   string    `json:"browser"`           // Browser name
+	Device    string    `json:"device"`            // Device class
+	Country   string    `json:"country,omitempty"` // Country code (with a GeoIP database)
+	Timestamp time.Time `json:"timestamp"`         // When the hit was recorded
+}
+
+// newLiveEvent sanitizes a stored page view for streaming
+func newLiveEvent(pv PageView, website Website) LiveEvent {
+	return LiveEvent{
+		Page:      pagePath(pv.PageURL),
+		Title:     scrubText(pv.PageTitle, website.Scrub),
+		Source:    referrerSource(pv, website),
+		Event:     pv.Event,
+		Browser:   pv.Browser,
+		Device:    pv.Device,
+		Country:   pv.Country,
+		Timestamp: pv.Timestamp,
+	}
+}
+
+// liveHub fans out new page views to the stream subscribers of each website
+// Subscribers receive the stored page view so they can apply their own filters before sanitizing it
+type liveHub struct {
+	mu          sync.Mutex
+	subscribers map[chan PageView]string // Subscriber channel -> website ID
+}
+
+// live is the process-wide hub fed by trackHandler
+var live = &liveHub{subscribers: make(map[chan PageView]string)}
+
+// subscribe registers a subscriber for a website's page views
+// It returns false when the subscriber limit has been reached
+func (h *liveHub) subscribe(websiteID string) (chan PageView, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subscribers) >= maxLiveSubscribers {
+		return nil, false
+	}
+	ch := make(chan PageView, 16)
+	h.subscribers[ch] = websiteID
+	return ch, true
+}
+
+// unsubscribe removes a subscriber
+func (h *liveHub) unsubscribe(ch chan PageView) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
+
+// publish sends a new page view to every subscriber of its website
+// Slow subscribers miss events rather than holding up tracking requests
+func (h *liveHub) publish(pv PageView) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, id := range h.subscribers {
+		if id != pv.WebsiteID {
+			continue
+		}
+		select {
+		case ch <- pv:
+		default:
+		}
+	}
+}
+
+// buildRealtime counts active visitors, their current pages and recent referrers
+// Visitors are identified by visitor ID, falling back to session ID; anonymous hits
+// cannot be linked, so each one counts as a separate visitor.
+func buildRealtime(pageViews []PageView, website Website) Realtime {
+	latest := make(map[string]PageView)
+	for _, pv := range pageViews {
+		key := pv.VisitorID
+		if key == "" {
+			key = pv.SessionID
+		}
+		if key == "" {
+			key = pv.ID
+		}
+		if current, ok := latest[key]; !ok || !pv.Timestamp.Before(current.Timestamp) {
+			latest[key] = pv
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, pv := range latest {
+		counts[pagePath(pv.PageURL)]++
+	}
+	pages := []RealtimePage{}
+	for page, visitors := range counts {
+		pages = append(pages, RealtimePage{Page: page, Visitors: visitors})
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Visitors != pages[j].Visitors {
+			return pages[i].Visitors > pages[j].Visitors
+		}
+		return pages[i].Page < pages[j].Page
+	})
+
+	return Realtime{
+		Visitors:  len(latest),
+		Pages:     pages,
+		Referrers: referrerReport(pageViews, website, 10),
+	}
+}
+
+// realtimeHandler serves the visitors active in the last 5 minutes
+// Filters are supported; period parameters are ignored
+func realtimeHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	now := time.Now()
+	query.Start, query.End = now.Add(-realtimeWindow), now.Add(time.Minute) // Allow for slightly fast client clocks
+
+	records, err := loadReportViews(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildRealtime(pageViewsOnly(records), query.Website))
+}
+
+// liveStreamHandler pushes each new page view and event for a website as a Server-Sent Event
+// Each message is a "pageview" event whose data is a LiveEvent in JSON. Filters are applied to each
+// hit on its own (see matchesFilters); period parameters are ignored.
+func liveStreamHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events, ok := live.subscribe(query.Website.ID)
+	if !ok {
+		http.Error(w, "Too many live connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer live.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case pv := <-events:
+			if !matchesFilters(pv, query.Filters, query.Website) {
+				continue
+			}
+			data, err := json.Marshal(newLiveEvent(pv, query.Website))
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: pageview\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
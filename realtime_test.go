@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json" // For checking what a stream event exposes
+	"strings"       // For searching the encoded event
+	"testing"       // For the test runner
+	"time"          // For activity windows
+)
+
+// =============================================================================
+// REALTIME TESTS
+// =============================================================================
+
+func TestNewLiveEvent(t *testing.T) {
+	website := Website{ID: "site", Domain: "example.com", Scrub: &ScrubRules{RedactEmails: true, RedactUUIDs: true}}
+	pv := PageView{
+		WebsiteID: "site",
+		SessionID: "session-secret",
+		VisitorID: "visitor-secret",
+		PageURL:   "https://example.com/orders?token=query-secret",
+		PageTitle: "Order 123e4567-e89b-12d3-a456-426614174000 for jane@example.org",
+		Referrer:  "https://www.google.com/",
+		UserAgent: "agent-secret",
+		Props:     map[string]string{"plan": "prop-secret"},
+		Browser:   "Firefox",
+		Device:    "Desktop",
+	}
+
+	event := newLiveEvent(pv, website)
+	if event.Page != "/orders" {
+		t.Errorf("Page = %q, want the path without the query string", event.Page)
+	}
+	if event.Title != "Order [uuid] for [email]" {
+		t.Errorf("Title = %q, want it scrubbed", event.Title)
+	}
+	if event.Source != "Google" {
+		t.Errorf("Source = %q, want Google", event.Source)
+	}
+	data, _ := json.Marshal(event)
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("live event leaks identifiers or properties: %s", data)
+	}
+
+	// Without scrubbing rules the title is passed through
+	if event := newLiveEvent(pv, Website{ID: "site"}); event.Title != pv.PageTitle {
+		t.Errorf("Title without rules = %q, want %q", event.Title, pv.PageTitle)
+	}
+}
+
+func TestLiveHub(t *testing.T) {
+	hub := &liveHub{subscribers: make(map[chan PageView]string)}
+	site, other := "site", "other"
+
+	ch, ok := hub.subscribe(site)
+	if !ok {
+		t.Fatal("subscribe refused the first subscriber")
+	}
+	otherCh, _ := hub.subscribe(other)
+
+	hub.publish(PageView{ID: "1", WebsiteID: site})
+	select {
+	case pv := <-ch:
+		if pv.ID != "1" {
+			t.Errorf("received %q, want 1", pv.ID)
+		}
+	default:
+		t.Error("subscriber did not receive its website's page view")
+	}
+	select {
+	case pv := <-otherCh:
+		t.Errorf("subscriber of another website received %q", pv.ID)
+	default:
+	}
+
+	// A subscriber that stops reading misses events instead of blocking tracking
+	for i := 0; i < cap(ch)+5; i++ {
+		hub.publish(PageView{WebsiteID: site})
+	}
+	if len(ch) != cap(ch) {
+		t.Errorf("buffer holds %d events, want it full at %d", len(ch), cap(ch))
+	}
+
+	hub.unsubscribe(ch)
+	hub.unsubscribe(otherCh)
+	if len(hub.subscribers) != 0 {
+		t.Errorf("%d subscribers left after unsubscribing", len(hub.subscribers))
+	}
+
+	// The number of open streams is capped
+	for i := 0; i < maxLiveSubscribers; i++ {
+		if _, ok := hub.subscribe(site); !ok {
+			t.Fatalf("subscriber %d refused below the limit", i+1)
+		}
+	}
+	if _, ok := hub.subscribe(site); ok {
+		t.Error("subscribe accepted a subscriber over the limit")
+	}
+}
+
+func TestBuildRealtime(t *testing.T) {
+	now := time.Now()
+	views := []PageView{
+		{ID: "1", VisitorID: "v1", PageURL: "https://example.com/", Timestamp: now.Add(-3 * time.Minute)},
+		{ID: "2", VisitorID: "v1", PageURL: "https://example.com/pricing", Timestamp: now.Add(-1 * time.Minute)},
+		{ID: "3", VisitorID: "v2", PageURL: "https://example.com/pricing", Timestamp: now.Add(-2 * time.Minute)},
+		{ID: "4", SessionID: "s3", PageURL: "https://example.com/", Timestamp: now},
+		{ID: "5", PageURL: "https://example.com/", Timestamp: now}, // Anonymous: counted on its own
+	}
+
+	realtime := buildRealtime(views, Website{ID: "site"})
+	if realtime.Visitors != 4 {
+		t.Errorf("Visitors = %d, want 4", realtime.Visitors)
+	}
+	// Each visitor counts once, on the page they viewed last
+	want := map[string]int{"/pricing": 2, "/": 2}
+	if len(realtime.Pages) != len(want) {
+		t.Fatalf("Pages = %+v, want %v", realtime.Pages, want)
+	}
+	for _, page := range realtime.Pages {
+		if page.Visitors != want[page.Page] {
+			t.Errorf("%s has %d visitors, want %d", page.Page, page.Visitors, want[page.Page])
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/url" // For parsing referrer URLs
+	"strings" // For string manipulation
+)
+
+// =============================================================================
+// REFERRER ANALYSIS
+// =============================================================================
+
+// Traffic channels used to group referrers
+const (
+	channelDirect   = "Direct"
+	channelOrganic  = "Organic Search"
+	channelSocial   = "Social"
+	channelReferral = "Referral"
+	channelEmail    = "Email"
+	channelPaid     = "Paid"
+)
+
+// ReferrerRow is a single row of the referrer report
+type ReferrerRow struct {
+	BreakdownRow
+	Channel string `json:"channel"` // Channel the source belongs to (e.g., "Organic Search")
+}
+
+// knownSource is a named traffic source and the channel it belongs to
+type knownSource struct {
+	Name    string
+	Channel string
+}
+
+// knownHosts maps normalized referrer hosts to named sources
+// Hosts are matched exactly or as a parent domain (e.g., "old.reddit.com" matches "reddit.com")
+var knownHosts = map[string]knownSource{
+	"google.com":           {Name: "Google", Channel: channelOrganic},
+	"bing.com":             {Name: "Bing", Channel: channelOrganic},
+	"duckduckgo.com":       {Name: "DuckDuckGo", Channel: channelOrganic},
+	"search.yahoo.com":     {Name: "Yahoo", Channel: channelOrganic},
+	"yandex.ru":            {Name: "Yandex", Channel: channelOrganic},
+	"baidu.com":            {Name: "Baidu", Channel: channelOrganic},
+	"ecosia.org":           {Name: "Ecosia", Channel: channelOrganic},
+	"search.brave.com":     {Name: "Brave Search", Channel: channelOrganic},
+	"twitter.com":          {Name: "Twitter/X", Channel: channelSocial},
+	"x.com":                {Name: "Twitter/X", Channel: channelSocial},
+	"t.co":                 {Name: "Twitter/X", Channel: channelSocial},
+	"reddit.com":           {Name: "Reddit", Channel: channelSocial},
+	"news.ycombinator.com": {Name: "Hacker News", Channel: channelSocial},
+	"facebook.com":         {Name: "Facebook", Channel: channelSocial},
+	"l.facebook.com":       {Name: "Facebook", Channel: channelSocial},
+	"instagram.com":        {Name: "Instagram", Channel: channelSocial},
+	"linkedin.com":         {Name: "LinkedIn", Channel: channelSocial},
+	"lnkd.in":              {Name: "LinkedIn", Channel: channelSocial},
+	"youtube.com":          {Name: "YouTube", Channel: channelSocial},
+	"mastodon.social":      {Name: "Mastodon", Channel: channelSocial},
+	"mail.google.com":      {Name: "Gmail", Channel: channelEmail},
+	"outlook.live.com":     {Name: "Outlook", Channel: channelEmail},
+	"mail.yahoo.com":       {Name: "Yahoo Mail", Channel: channelEmail},
+}
+
+// googleSuffixes are the public suffixes of Google's country search domains (google.de, google.co.uk, ...)
+// Only "google." followed by exactly one of these counts as Google, so hosts like google.evil.com do not
+var googleSuffixes = map[string]bool{
+	"com": true, "ad": true, "ae": true, "al": true, "am": true, "as": true, "at": true, "az": true, "ba": true,
+	"be": true, "bg": true, "by": true, "ca": true, "ch": true, "cl": true, "cn": true, "cz": true, "de": true,
+	"dk": true, "ee": true, "es": true, "fi": true, "fr": true, "ge": true, "gr": true, "hr": true, "hu": true,
+	"ie": true, "is": true, "it": true, "kz": true, "li": true, "lk": true, "lt": true, "lu": true, "lv": true,
+	"md": true, "mk": true, "mn": true, "nl": true, "no": true, "pl": true, "pt": true, "ro": true, "rs": true,
+	"ru": true, "se": true, "si": true, "sk": true,
+	"co.id": true, "co.il": true, "co.in": true, "co.jp": true, "co.ke": true, "co.kr": true, "co.nz": true,
+	"co.th": true, "co.uk": true, "co.za": true,
+	"com.ar": true, "com.au": true, "com.bd": true, "com.br": true, "com.co": true, "com.eg": true, "com.hk": true,
+	"com.mx": true, "com.my": true, "com.ng": true, "com.pe": true, "com.ph": true, "com.pk": true, "com.sa": true,
+	"com.sg": true, "com.tr": true, "com.tw": true, "com.ua": true, "com.vn": true,
+}
+
+// sourceChannels maps each named source in knownHosts to its channel
+var sourceChannels = func() map[string]string {
+	index := make(map[string]string)
+	for _, source := range knownHosts {
+		index[source.Name] = source.Channel
+	}
+	return index
+}()
+
+// paidMediums and emailMediums are utm_medium values that override the referrer's channel
+var (
+	paidMediums  = map[string]bool{"cpc": true, "ppc": true, "paid": true, "paidsearch": true, "paid_social": true, "display": true, "cpm": true, "banner": true}
+	emailMediums = map[string]bool{"email": true, "e-mail": true, "newsletter": true}
+)
+
+// normalizeHost reduces a URL or bare domain to a lowercase host without "www." or a port
+// It returns an empty string if no host can be found
+func normalizeHost(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	// Bare domains like "example.com" parse as a path, so give them a scheme first
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	return strings.TrimPrefix(host, "www.")
+}
+
+// lookupSource finds the named source for a normalized host
+// Hosts match a known host exactly or as a subdomain of one. Google's country domains
+// (google.de, google.co.uk, ...) all map to Google, but only with a known suffix.
+func lookupSource(host string) (knownSource, bool) {
+	for h := host; h != ""; {
+		if source, ok := knownHosts[h]; ok {
+			return source, true
+		}
+		if suffix, ok := strings.CutPrefix(h, "google."); ok && googleSuffixes[suffix] {
+			return knownHosts["google.com"], true
+		}
+		dot := strings.Index(h, ".")
+		if dot < 0 {
+			break
+		}
+		h = h[dot+1:]
+	}
+	return knownSource{}, false
+}
+
+// isSelfReferral reports whether the referrer host belongs to the website's own domain
+func isSelfReferral(host string, website Website) bool {
+	siteHost := normalizeHost(website.Domain)
+	return siteHost != "" && (host == siteHost || strings.HasSuffix(host, "."+siteHost))
+}
+
+// referrerSource returns the named source for a page view's referrer
+// Unknown hosts are reported by host name; self-referrals and direct visits return an empty string
+func referrerSource(pv PageView, website Website) string {
+	host := normalizeHost(pv.Referrer)
+	if host == "" || isSelfReferral(host, website) {
+		return ""
+	}
+	if source, ok := lookupSource(host); ok {
+		return source.Name
+	}
+	return host
+}
+
+// trafficChannel groups a page view into an acquisition channel
+// Internal navigation (self-referrals) returns an empty string so it is not counted as a new arrival
+func trafficChannel(pv PageView, website Website) string {
+	// An explicit utm_medium wins over whatever the referrer implies
+	switch {
+	case paidMediums[pv.UTMMedium]:
+		return channelPaid
+	case emailMediums[pv.UTMMedium]:
+		return channelEmail
+	case pv.UTMMedium == "social":
+		return channelSocial
+	}
+
+	host := normalizeHost(pv.Referrer)
+	if host != "" && isSelfReferral(host, website) {
+		return ""
+	}
+	if host == "" {
+		// Tagged links opened from apps or email clients arrive without a referrer
+		if pv.UTMSource != "" {
+			return channelReferral
+		}
+		return channelDirect
+	}
+	if source, ok := lookupSource(host); ok {
+		return source.Channel
+	}
+	return channelReferral
+}
+
+// referrerReport groups external referrers by source and attaches each source's channel
+// The channel here describes the source itself; campaign tags are reflected in the channel breakdown instead
+func referrerReport(pageViews []PageView, website Website, limit int) []ReferrerRow {
+	rows := []ReferrerRow{}
+	sources := breakdown(pageViews, func(pv PageView) string { return referrerSource(pv, website) }, limit)
+	for _, row := range sources {
+		// Named sources come from knownHosts; anything else is reported by its host
+		channel, ok := sourceChannels[row.Name]
+		if !ok {
+			channel = channelReferral
+		}
+		rows = append(rows, ReferrerRow{BreakdownRow: row, Channel: channel})
+	}
+	return rows
+}
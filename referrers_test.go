@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing" // For the test runner
+)
+
+// =============================================================================
+// REFERRER ANALYSIS TESTS
+// =============================================================================
+
+func TestLookupSource(t *testing.T) {
+	tests := []struct {
+		host    string
+		name    string // Expected source name; empty when the host is unknown
+		channel string
+	}{
+		{host: "google.com", name: "Google", channel: channelOrganic},
+		{host: "google.de", name: "Google", channel: channelOrganic},
+		{host: "google.co.uk", name: "Google", channel: channelOrganic},
+		{host: "google.com.au", name: "Google", channel: channelOrganic},
+		{host: "news.google.com", name: "Google", channel: channelOrganic},
+		{host: "mail.google.com", name: "Gmail", channel: channelEmail},
+		{host: "old.reddit.com", name: "Reddit", channel: channelSocial},
+		{host: "t.co", name: "Twitter/X", channel: channelSocial},
+		{host: "google.evil.com"},
+		{host: "google.com.evil.com"},
+		{host: "google.co.evil"},
+		{host: "evilgoogle.com"},
+		{host: "notreddit.com"},
+		{host: "example.com"},
+	}
+	for _, tt := range tests {
+		source, ok := lookupSource(tt.host)
+		if ok != (tt.name != "") || source.Name != tt.name || source.Channel != tt.channel {
+			t.Errorf("lookupSource(%q) = %+v, %v; want {%s %s}", tt.host, source, ok, tt.name, tt.channel)
+		}
+	}
+}
+
+func TestReferrerReportChannels(t *testing.T) {
+	website := Website{ID: "site", Domain: "example.com"}
+	pageViews := []PageView{
+		{Referrer: "https://www.google.de/search?q=x"},
+		{Referrer: "https://google.evil.com/"},
+		{Referrer: "https://mail.google.com/"},
+		{Referrer: "https://example.com/other"}, // Self-referral, not reported
+		{Referrer: ""},                          // Direct, not reported
+	}
+	want := map[string]string{
+		"Google":          channelOrganic,
+		"Gmail":           channelEmail,
+		"google.evil.com": channelReferral,
+	}
+
+	rows := referrerReport(pageViews, website, 10)
+	if len(rows) != len(want) {
+		t.Fatalf("referrerReport returned %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for _, row := range rows {
+		if channel, ok := want[row.Name]; !ok || row.Channel != channel {
+			t.Errorf("row %q has channel %q, want %q", row.Name, row.Channel, want[row.Name])
+		}
+	}
+}
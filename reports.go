@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"   // For classifying query errors
+	"fmt"      // For error formatting
+	"log"      // For logging configuration problems
+	"net/http" // For reading query parameters
+	"strconv"  // For parsing numeric parameters
+	"time"     // For date ranges and time zones
+
+	_ "time/tzdata" // Embed the time zone database so website time zones work on minimal hosts
+
+	"github.com/gorilla/mux" // For reading the tracking ID from the URL
+)
+
+// =============================================================================
+// REPORT QUERIES
+// =============================================================================
+
+// reportQuery holds the parameters shared by every stats endpoint
+type reportQuery struct {
+	Website  Website        // Website being reported on (only the ID is set if it is not registered)
+	Location *time.Location // Reporting time zone used for date ranges and day buckets
+	Period   string         // Named period (today, 7d, 30d, month, year or custom)
+	Start    time.Time      // Start of the range (inclusive)
+	End      time.Time      // End of the range (exclusive)
+	Filters  []Filter       // Dimension filters, all of which must match
+	Compare  string         // Comparison period: "", "previous" or "year"
+}
+
+// DateRange describes the resolved reporting period in API responses
+type DateRange struct {
+	Period   string `json:"period"`   // Named period that was requested
+	From     string `json:"from"`     // First day of the range (YYYY-MM-DD, inclusive)
+	To       string `json:"to"`       // Last day of the range (YYYY-MM-DD, inclusive)
+	Timezone string `json:"timezone"` // Reporting time zone (IANA name)
+}
+
+// defaultPeriod is used when a request names no period and no from/to dates
+const defaultPeriod = "30d"
+
+// queryError is a problem with the request's parameters, reported as 400 Bad Request
+type queryError struct {
+	message string
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+// badQuery creates a queryError with a formatted message
+func badQuery(format string, args ...interface{}) error {
+	return &queryError{message: fmt.Sprintf(format, args...)}
+}
+
+// writeQueryError responds with 400 for invalid parameters and 500 for anything else
+func writeQueryError(w http.ResponseWriter, err error) {
+	var qe *queryError
+	if errors.As(err, &qe) {
+		http.Error(w, qe.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Error building report: %v", err)
+	http.Error(w, "Server error: could not build report", http.StatusInternalServerError)
+}
+
+// websiteLocation returns the website's reporting time zone, falling back to UTC
+func websiteLocation(website Website) *time.Location {
+	if website.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(website.Timezone)
+	if err != nil {
+		log.Printf("Website %s has invalid timezone %q, using UTC: %v", website.ID, website.Timezone, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// parseReportQuery resolves the website, time zone, date range and filters for a stats request
+// Supported parameters: period=today|7d|30d|month|year|custom, from/to (YYYY-MM-DD, inclusive)
+// any number of filter=<dimension><op><value> conditions and compare=previous|year
+func parseReportQuery(r *http.Request) (reportQuery, error) {
+	trackingID := mux.Vars(r)["trackingId"]
+	website, found, err := findWebsite(trackingID)
+	if err != nil {
+		return reportQuery{}, fmt.Errorf("could not read websites file: %w", err)
+	}
+	if !found {
+		// Unknown IDs simply report no data
+		website = Website{ID: trackingID}
+	}
+
+	query := reportQuery{Website: website, Location: websiteLocation(website)}
+	params := r.URL.Query()
+	query.Period = params.Get("period")
+	from, to := params.Get("from"), params.Get("to")
+	if query.Period == "" {
+		query.Period = defaultPeriod
+		if from != "" || to != "" {
+			query.Period = "custom"
+		}
+	}
+
+	query.Start, query.End, err = periodRange(query.Period, from, to, time.Now(), query.Location)
+	if err != nil {
+		return reportQuery{}, err
+	}
+
+	// e.g., ?filter=page==/blog/*&filter=browser==Firefox
+	if query.Filters, err = parseFilters(params["filter"]); err != nil {
+		return reportQuery{}, err
+	}
+	if query.Compare, err = parseCompare(params.Get("compare")); err != nil {
+		return reportQuery{}, err
+	}
+	return query, nil
+}
+
+// maxLimit caps the number of rows a report endpoint returns in one response
+const maxLimit = 1000
+
+// parseLimit reads the limit query parameter, falling back to def when it is not given
+func parseLimit(r *http.Request, def int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, badQuery("invalid limit %q: use a number from 1 to %d", value, maxLimit)
+	}
+	return limit, nil
+}
+
+// maxOffset caps the offset parameter; no report has anywhere near this many rows
+const maxOffset = 1000000
+
+// parseOffset reads the offset query parameter used to page through rows, defaulting to 0
+func parseOffset(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("offset")
+	if value == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 || offset > maxOffset {
+		return 0, badQuery("invalid offset %q: use a number of rows to skip from 0 to %d", value, maxOffset)
+	}
+	return offset, nil
+}
+
+// periodRange computes the [start, end) range for a named period in the given time zone
+// Ranges are aligned to whole days; "month" and "year" run to the end of the current month or year
+func periodRange(period, from, to string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	switch period {
+	case "today":
+		return today, tomorrow, nil
+	case "7d":
+		return today.AddDate(0, 0, -6), tomorrow, nil
+	case "30d":
+		return today.AddDate(0, 0, -29), tomorrow, nil
+	case "month":
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0), nil
+	case "year":
+		start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0), nil
+	case "custom":
+		if from == "" || to == "" {
+			return time.Time{}, time.Time{}, badQuery("period=custom requires both from and to (YYYY-MM-DD)")
+		}
+		start, err := time.ParseInLocation("2006-01-02", from, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, badQuery("invalid from date %q: use YYYY-MM-DD", from)
+		}
+		last, err := time.ParseInLocation("2006-01-02", to, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, badQuery("invalid to date %q: use YYYY-MM-DD", to)
+		}
+		if last.Before(start) {
+			return time.Time{}, time.Time{}, badQuery("to date %s is before from date %s", to, from)
+		}
+		return start, last.AddDate(0, 0, 1), nil
+	default:
+		return time.Time{}, time.Time{}, badQuery("unknown period %q: use today, 7d, 30d, month, year or custom", period)
+	}
+}
+
+// dateRange describes the query's range for API responses
+func (q reportQuery) dateRange() DateRange {
+	return DateRange{
+		Period:   q.Period,
+		From:     q.Start.Format("2006-01-02"),
+		To:       q.End.Add(-time.Nanosecond).Format("2006-01-02"), // End is exclusive and may fall mid-day for comparisons
+		Timezone: q.Location.String(),
+	}
+}
+
+// day formats a timestamp as a calendar day in the reporting time zone
+func (q reportQuery) day(t time.Time) string {
+	return t.In(q.Location).Format("2006-01-02")
+}
+
+// loadReportViews reads the records for the query's website within its date range that pass its filters
+// The result includes custom events; use pageViewsOnly for page view metrics
+func loadReportViews(q reportQuery) ([]PageView, error) {
+	views, err := loadRangeViews(q)
+	if err != nil {
+		return nil, err
+	}
+	return applyFilters(views, q.Filters, q.Website), nil
+}
+
+// loadRangeViews reads every record for the query's website within its date range, ignoring filters
+func loadRangeViews(q reportQuery) ([]PageView, error) {
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return nil, fmt.Errorf("could not read page views: %w", err)
+	}
+	var views []PageView
+	for _, pv := range pageViews {
+		if pv.WebsiteID == q.Website.ID && !pv.Timestamp.Before(q.Start) && pv.Timestamp.Before(q.End) {
+			views = append(views, pv)
+		}
+	}
+	return views, nil
+}
+
+// loadSessionRecords reads every record of the sessions selected by the query's filters
+// Filters choose which sessions count, but session metrics (bounce rate, duration, entry and exit
+// pages, paths, funnels) need all of a session's records: with page==/pricing, a session that viewed
+// /pricing and two other pages must still have three page views.
+func loadSessionRecords(q reportQuery) ([]PageView, error) {
+	views, err := loadRangeViews(q)
+	if err != nil {
+		return nil, err
+	}
+	return sessionRecords(views, applyFilters(views, q.Filters, q.Website)), nil
+}
+
+// sessionRecords returns the records in all whose session has at least one record in matched
+// Records without a session ID cannot form sessions and are only kept when nothing was filtered out
+func sessionRecords(all, matched []PageView) []PageView {
+	if len(matched) == len(all) {
+		return all // No filters, or every record matched
+	}
+	selected := make(map[string]bool)
+	for _, pv := range matched {
+		if pv.SessionID != "" {
+			selected[pv.SessionID] = true
+		}
+	}
+	var records []PageView
+	for _, pv := range all {
+		if selected[pv.SessionID] {
+			records = append(records, pv)
+		}
+	}
+	return records
+}
+
+// pageViewsOnly drops custom events, keeping page loads (including 404 pages)
+func pageViewsOnly(records []PageView) []PageView {
+	var views []PageView
+	for _, pv := range records {
+		if isPageView(pv) {
+			views = append(views, pv)
+		}
+	}
+	return views
+}
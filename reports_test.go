@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"  // For classifying query errors
+	"testing" // For the test runner
+	"time"    // For building expected ranges
+)
+
+// =============================================================================
+// TEST HELPERS
+// =============================================================================
+
+// mustLocation loads a time zone or fails the test
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+// at parses a "2006-01-02 15:04" time in loc or fails the test
+func at(t *testing.T, value string, loc *time.Location) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatalf("bad test time %q: %v", value, err)
+	}
+	return parsed
+}
+
+// =============================================================================
+// PERIOD RANGE TESTS
+// =============================================================================
+
+func TestPeriodRange(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	// US daylight saving time starts at 02:00 on 8 March 2026, so that day has 23 hours
+	dstDay := at(t, "2026-03-08 15:00", newYork)
+
+	tests := []struct {
+		name      string
+		period    string
+		from, to  string
+		now       time.Time
+		loc       *time.Location
+		wantStart string
+		wantEnd   string
+	}{
+		{name: "today", period: "today", now: at(t, "2026-09-18 10:00", time.UTC), loc: time.UTC,
+			wantStart: "2026-09-18 00:00", wantEnd: "2026-09-19 00:00"},
+		{name: "today in the website's zone, not UTC", period: "today",
+			now: at(t, "2026-09-18 03:00", time.UTC), loc: newYork, // 23:00 on the 17th in New York
+			wantStart: "2026-09-17 00:00", wantEnd: "2026-09-18 00:00"},
+		{name: "today on a DST change", period: "today", now: dstDay, loc: newYork,
+			wantStart: "2026-03-08 00:00", wantEnd: "2026-03-09 00:00"},
+		{name: "7d across a DST change", period: "7d", now: dstDay, loc: newYork,
+			wantStart: "2026-03-02 00:00", wantEnd: "2026-03-09 00:00"},
+		{name: "30d across a month boundary", period: "30d", now: dstDay, loc: newYork,
+			wantStart: "2026-02-07 00:00", wantEnd: "2026-03-09 00:00"},
+		{name: "month", period: "month", now: dstDay, loc: newYork,
+			wantStart: "2026-03-01 00:00", wantEnd: "2026-04-01 00:00"},
+		{name: "month on its last day", period: "month", now: at(t, "2026-01-31 23:59", time.UTC), loc: time.UTC,
+			wantStart: "2026-01-01 00:00", wantEnd: "2026-02-01 00:00"},
+		{name: "month in a leap year February", period: "month", now: at(t, "2028-02-29 12:00", time.UTC), loc: time.UTC,
+			wantStart: "2028-02-01 00:00", wantEnd: "2028-03-01 00:00"},
+		{name: "year", period: "year", now: dstDay, loc: newYork,
+			wantStart: "2026-01-01 00:00", wantEnd: "2027-01-01 00:00"},
+		{name: "custom includes the to date", period: "custom", from: "2026-02-27", to: "2026-03-02", now: dstDay, loc: newYork,
+			wantStart: "2026-02-27 00:00", wantEnd: "2026-03-03 00:00"},
+		{name: "custom single day", period: "custom", from: "2026-03-08", to: "2026-03-08", now: dstDay, loc: newYork,
+			wantStart: "2026-03-08 00:00", wantEnd: "2026-03-09 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := periodRange(tt.period, tt.from, tt.to, tt.now, tt.loc)
+			if err != nil {
+				t.Fatalf("periodRange: %v", err)
+			}
+			wantStart, wantEnd := at(t, tt.wantStart, tt.loc), at(t, tt.wantEnd, tt.loc)
+			if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+				t.Errorf("periodRange = [%s, %s), want [%s, %s)", start, end, wantStart, wantEnd)
+			}
+			if start.Location() != tt.loc {
+				t.Errorf("start is in %s, want %s", start.Location(), tt.loc)
+			}
+		})
+	}
+
+	// The DST day really is shorter; ranges are built from calendar days, not fixed hours
+	start, end, _ := periodRange("today", "", "", dstDay, newYork)
+	if hours := end.Sub(start).Hours(); hours != 23 {
+		t.Errorf("today on the DST change spans %v hours, want 23", hours)
+	}
+}
+
+func TestPeriodRangeErrors(t *testing.T) {
+	now := at(t, "2026-09-18 10:00", time.UTC)
+	tests := []struct {
+		name     string
+		period   string
+		from, to string
+	}{
+		{name: "unknown period", period: "week"},
+		{name: "custom without dates", period: "custom"},
+		{name: "custom without to", period: "custom", from: "2026-09-01"},
+		{name: "invalid from", period: "custom", from: "2026-9-1", to: "2026-09-10"},
+		{name: "invalid to", period: "custom", from: "2026-09-01", to: "tomorrow"},
+		{name: "impossible date", period: "custom", from: "2026-02-30", to: "2026-03-01"},
+		{name: "to before from", period: "custom", from: "2026-09-10", to: "2026-09-01"},
+	}
+	for _, tt := range tests {
+		_, _, err := periodRange(tt.period, tt.from, tt.to, now, time.UTC)
+		var qe *queryError
+		if !errors.As(err, &qe) {
+			t.Errorf("%s: got %v, want a queryError (400)", tt.name, err)
+		}
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	q := reportQuery{
+		Location: newYork,
+		Period:   "month",
+		Start:    at(t, "2026-03-01 00:00", newYork),
+		End:      at(t, "2026-04-01 00:00", newYork),
+	}
+	want := DateRange{Period: "month", From: "2026-03-01", To: "2026-03-31", Timezone: "America/New_York"}
+	if got := q.dateRange(); got != want {
+		t.Errorf("dateRange = %+v, want %+v", got, want)
+	}
+
+	// A range ending mid-day (a partial comparison period) reports that day as its last
+	q.End = at(t, "2026-03-18 10:00", newYork)
+	if got := q.dateRange().To; got != "2026-03-18" {
+		t.Errorf("dateRange To for a mid-day end = %q, want 2026-03-18", got)
+	}
+}
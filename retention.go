@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json" // For encoding the response
+	"net/http"      // For the retention handler
+	"time"          // For cohort buckets
+)
+
+// =============================================================================
+// COHORT RETENTION
+// =============================================================================
+
+// Retention is the response of the /stats/{trackingId}/retention endpoint
+type Retention struct {
+	Range    DateRange `json:"range"`    // Period in which cohorts were first seen
+	Interval string    `json:"interval"` // Cohort size: week or month
+	Cohorts  []Cohort  `json:"cohorts"`  // One row per period with new users, oldest first
+}
+
+// Cohort is one row of the retention table: the users first seen in one period
+type Cohort struct {
+	Start     string    `json:"start"`     // First day (YYYY-MM-DD) or month (YYYY-MM) of the cohort's period
+	Users     int       `json:"users"`     // Users first seen in this period
+	Returning []int     `json:"returning"` // Users active in each period since, starting with the cohort's own (always Users)
+	Retention []float64 `json:"retention"` // Returning as a percentage of Users
+}
+
+// buildRetention groups identified users into cohorts by the period they were first seen in,
+// then counts how many were active in each following period up to the end of the query range (or now).
+// history must contain every record up to the end of the range so first-seen dates are accurate.
+// Records without a user ID are ignored.
+func buildRetention(history []PageView, q reportQuery, interval string) []Cohort {
+	firstSeen := make(map[string]time.Time)
+	active := make(map[string]map[string]bool) // user -> labels of periods with activity
+	for _, pv := range history {
+		if pv.UserID == "" {
+			continue
+		}
+		if first, ok := firstSeen[pv.UserID]; !ok || pv.Timestamp.Before(first) {
+			firstSeen[pv.UserID] = pv.Timestamp
+		}
+		if active[pv.UserID] == nil {
+			active[pv.UserID] = make(map[string]bool)
+		}
+		active[pv.UserID][bucketLabel(bucketStart(pv.Timestamp, interval, q.Location), interval)] = true
+	}
+
+	// Cohort members, keyed by the label of the period they were first seen in
+	members := make(map[string][]string)
+	for user, first := range firstSeen {
+		if first.Before(q.Start) {
+			continue // Already a returning user when the range starts
+		}
+		label := bucketLabel(bucketStart(first, interval, q.Location), interval)
+		members[label] = append(members[label], user)
+	}
+
+	// Periods that have not started yet (e.g. later this year for period=year) are left out
+	end := q.End
+	if now := time.Now(); now.Before(end) {
+		end = now
+	}
+
+	cohorts := []Cohort{}
+	for start := bucketStart(q.Start, interval, q.Location); start.Before(end); start = nextBucket(start, interval, q.Location) {
+		users := members[bucketLabel(start, interval)]
+		if len(users) == 0 {
+			continue
+		}
+		cohort := Cohort{Start: bucketLabel(start, interval), Users: len(users), Returning: []int{}, Retention: []float64{}}
+		for period := start; period.Before(end); period = nextBucket(period, interval, q.Location) {
+			label := bucketLabel(period, interval)
+			returning := 0
+			for _, user := range users {
+				if active[user][label] {
+					returning++
+				}
+			}
+			cohort.Returning = append(cohort.Returning, returning)
+			cohort.Retention = append(cohort.Retention, float64(returning)*100/float64(len(users)))
+		}
+		cohorts = append(cohorts, cohort)
+	}
+	return cohorts
+}
+
+// retentionHandler serves weekly or monthly cohort retention for identified users
+// Accepts the usual period and filter parameters plus interval=week|month (default week).
+// The period selects when cohorts were first seen; activity is counted up to its end.
+func retentionHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+	if interval != "week" && interval != "month" {
+		writeQueryError(w, badQuery("unknown interval %q: use week or month", interval))
+		return
+	}
+
+	// Read everything before the range too, so users seen earlier are not counted as new
+	history := query
+	history.Start = time.Time{}
+	records, err := loadReportViews(history)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Retention{
+		Range:    query.dateRange(),
+		Interval: interval,
+		Cohorts:  buildRetention(records, query, interval),
+	})
+}
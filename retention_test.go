@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json" // For decoding handler responses
+	"net/http"      // For status codes
+	"testing"       // For the test runner
+	"time"          // For activity timestamps
+)
+
+// =============================================================================
+// COHORT RETENTION TESTS
+// =============================================================================
+
+// activity is one record of an identified user at a time in loc
+func activity(t *testing.T, user, when string, loc *time.Location) PageView {
+	return PageView{WebsiteID: "site", UserID: user, PageURL: "https://example.com/", Timestamp: at(t, when, loc)}
+}
+
+// checkCohorts compares cohorts with the expected rows
+func checkCohorts(t *testing.T, got, want []Cohort) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d cohorts %+v, want %d %+v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		same := g.Start == w.Start && g.Users == w.Users && len(g.Returning) == len(w.Returning) && len(g.Retention) == len(w.Retention)
+		for j := 0; same && j < len(w.Returning); j++ {
+			same = g.Returning[j] == w.Returning[j] && g.Retention[j] == w.Retention[j]
+		}
+		if !same {
+			t.Errorf("cohort %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestBuildRetentionWeekly(t *testing.T) {
+	// Three weeks starting Monday 2 March 2026
+	start, end, _ := periodRange("custom", "2026-03-02", "2026-03-22", time.Now(), time.UTC)
+	q := reportQuery{Location: time.UTC, Start: start, End: end}
+
+	history := []PageView{
+		// u0 was first seen before the range, so it is never a new user, however active it is
+		activity(t, "u0", "2026-02-20 09:00", time.UTC),
+		activity(t, "u0", "2026-03-03 09:00", time.UTC),
+		activity(t, "u0", "2026-03-10 09:00", time.UTC),
+		// u1 and u2 join in week 1 (records need not be in order)
+		activity(t, "u1", "2026-03-18 09:00", time.UTC),
+		activity(t, "u1", "2026-03-03 09:00", time.UTC),
+		activity(t, "u2", "2026-03-04 09:00", time.UTC),
+		activity(t, "u2", "2026-03-15 23:59", time.UTC), // Sunday: still week 2
+		// u3 joins in week 2 and is active several times in it
+		activity(t, "u3", "2026-03-09 00:00", time.UTC),
+		activity(t, "u3", "2026-03-11 12:00", time.UTC),
+		activity(t, "u3", "2026-03-20 12:00", time.UTC),
+		// Activity after the range is not counted
+		activity(t, "u2", "2026-03-25 12:00", time.UTC),
+		// Anonymous records cannot be followed
+		{WebsiteID: "site", PageURL: "https://example.com/", Timestamp: at(t, "2026-03-05 09:00", time.UTC)},
+	}
+
+	// Week 3 has no new users, so it has no row
+	checkCohorts(t, buildRetention(history, q, "week"), []Cohort{
+		{Start: "2026-03-02", Users: 2, Returning: []int{2, 1, 1}, Retention: []float64{100, 50, 50}},
+		{Start: "2026-03-09", Users: 1, Returning: []int{1, 1}, Retention: []float64{100, 100}},
+	})
+
+	if cohorts := buildRetention(nil, q, "week"); cohorts == nil || len(cohorts) != 0 {
+		t.Errorf("buildRetention without users = %#v, want an empty list", cohorts)
+	}
+}
+
+func TestBuildRetentionMonthly(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	start, end, _ := periodRange("custom", "2026-01-01", "2026-03-31", time.Now(), newYork)
+	q := reportQuery{Location: newYork, Start: start, End: end}
+
+	history := []PageView{
+		activity(t, "m0", "2025-12-15 12:00", newYork), // Seen before the range
+		activity(t, "m0", "2026-01-05 12:00", newYork),
+		// 03:00 UTC on 1 February is still 31 January in New York
+		{WebsiteID: "site", UserID: "m1", Timestamp: time.Date(2026, 2, 1, 3, 0, 0, 0, time.UTC)},
+		activity(t, "m1", "2026-03-31 23:00", newYork),
+		activity(t, "m2", "2026-02-10 12:00", newYork),
+		activity(t, "m3", "2026-02-28 12:00", newYork),
+		activity(t, "m3", "2026-03-01 00:30", newYork),
+	}
+
+	checkCohorts(t, buildRetention(history, q, "month"), []Cohort{
+		{Start: "2026-01", Users: 1, Returning: []int{1, 0, 1}, Retention: []float64{100, 0, 100}},
+		{Start: "2026-02", Users: 2, Returning: []int{2, 1}, Retention: []float64{100, 50}},
+	})
+}
+
+func TestBuildRetentionStopsAtNow(t *testing.T) {
+	// A range running into the future only has columns for periods that have started
+	now := time.Now().UTC()
+	start := bucketStart(now, "month", time.UTC)
+	q := reportQuery{Location: time.UTC, Start: start, End: start.AddDate(1, 0, 0)}
+	history := []PageView{{WebsiteID: "site", UserID: "u1", Timestamp: now}}
+
+	cohorts := buildRetention(history, q, "month")
+	if len(cohorts) != 1 || len(cohorts[0].Returning) != 1 {
+		t.Errorf("cohorts for a range ending next year = %+v, want one cohort with one period", cohorts)
+	}
+}
+
+func TestRetentionHandler(t *testing.T) {
+	now := time.Now().UTC()
+	useTestSite(t, []Website{{ID: "site"}}, []PageView{
+		{WebsiteID: "site", UserID: "old", Timestamp: now.AddDate(0, 0, -60)},
+		{WebsiteID: "site", UserID: "old", Timestamp: now},
+		{WebsiteID: "site", UserID: "new", Timestamp: now},
+	})
+
+	for query, want := range map[string]int{
+		"":                      http.StatusOK,
+		"interval=month":        http.StatusOK,
+		"interval=day":          http.StatusBadRequest,
+		"period=7d&interval=yr": http.StatusBadRequest,
+	} {
+		if w := serveStats(retentionHandler, "site", query); w.Code != want {
+			t.Errorf("retention?%s: status %d, want %d", query, w.Code, want)
+		}
+	}
+
+	// Records before the range are read, so "old" is not counted as a new user
+	var retention Retention
+	w := serveStats(retentionHandler, "site", "period=7d")
+	if err := json.Unmarshal(w.Body.Bytes(), &retention); err != nil {
+		t.Fatal(err)
+	}
+	users := 0
+	for _, c := range retention.Cohorts {
+		users += c.Users
+	}
+	if retention.Interval != "week" || users != 1 {
+		t.Errorf("retention?period=7d = %+v, want one new user in weekly cohorts", retention)
+	}
+}
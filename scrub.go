@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"    // For parsing command flags
+	"fmt"     // For printing command output
+	"net/url" // For parsing and unescaping URLs
+	"regexp"  // For redacting emails and UUIDs
+	"strings" // For string manipulation
+)
+
+// =============================================================================
+// URL SCRUBBING
+// =============================================================================
+
+// ScrubRules controls how page and referrer URLs are cleaned before they are stored
+// Rules are configured per website in websites.json under "scrub"
+type ScrubRules struct {
+	AllowParams   []string `json:"allow_params,omitempty"`   // If set, only these query parameters are kept (e.g., "page", "utm_*")
+	DenyParams    []string `json:"deny_params,omitempty"`    // Query parameters to remove (e.g., "token", "reset_*")
+	RedactEmails  bool     `json:"redact_emails,omitempty"`  // Replace email addresses anywhere in the URL with "[email]"
+	RedactUUIDs   bool     `json:"redact_uuids,omitempty"`   // Replace UUIDs anywhere in the URL with "[uuid]"
+	StripFragment bool     `json:"strip_fragment,omitempty"` // Remove everything after "#"
+}
+
+var (
+	// emailPattern matches email addresses, including a URL-encoded "@"
+	emailPattern = regexp.MustCompile(`(?i)[a-z0-9._%+-]+(?:@|%40)[a-z0-9.-]+\.[a-z]{2,}`)
+
+	// uuidPattern matches canonical 8-4-4-4-12 hex UUIDs
+	uuidPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// matchParam reports whether a query parameter name matches any pattern
+// Patterns are case-insensitive and may end in "*" to match a prefix
+func matchParam(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubURL applies the scrubbing rules to a URL and returns the cleaned URL
+// Query parameters keep their original order. A nil rule set returns the URL unchanged.
+func scrubURL(raw string, rules *ScrubRules) string {
+	if rules == nil || raw == "" {
+		return raw
+	}
+
+	scrubbed := raw
+	if u, err := url.Parse(raw); err == nil {
+		if rules.StripFragment {
+			u.Fragment = ""
+			u.RawFragment = ""
+		}
+		if u.RawQuery != "" && (len(rules.AllowParams) > 0 || len(rules.DenyParams) > 0) {
+			u.RawQuery = filterQuery(u.RawQuery, rules)
+		}
+		// Dropping every parameter would otherwise leave a dangling "?"
+		u.ForceQuery = false
+		scrubbed = u.String()
+	}
+
+	// Redaction runs on the whole string so values in paths, queries and fragments are all caught
+	return scrubText(scrubbed, rules)
+}
+
+// scrubText applies the email and UUID redaction rules to free text such as a page title
+// A nil rule set returns the text unchanged
+func scrubText(text string, rules *ScrubRules) string {
+	if rules == nil {
+		return text
+	}
+	if rules.RedactEmails {
+		text = emailPattern.ReplaceAllString(text, "[email]")
+	}
+	if rules.RedactUUIDs {
+		text = uuidPattern.ReplaceAllString(text, "[uuid]")
+	}
+	return text
+}
+
+// filterQuery keeps or drops raw query parameters according to the allow and deny lists
+func filterQuery(rawQuery string, rules *ScrubRules) string {
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		if len(rules.AllowParams) > 0 && !matchParam(key, rules.AllowParams) {
+			continue
+		}
+		if matchParam(key, rules.DenyParams) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	return strings.Join(kept, "&")
+}
+
+// runScrub re-applies each website's current scrubbing rules to stored page views
+func runScrub(args []string) error {
+	flags := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	websiteID := flags.String("website", "", "only process page views for this website ID")
+	dryRun := flags.Bool("dry-run", false, "report how many records would change without saving")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	websites, err := loadWebsiteMap()
+	if err != nil {
+		return fmt.Errorf("could not read websites: %w", err)
+	}
+
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return fmt.Errorf("could not read page views: %w", err)
+	}
+
+	changed := 0
+	for i, pv := range pageViews {
+		if *websiteID != "" && pv.WebsiteID != *websiteID {
+			continue
+		}
+		rules := websites[pv.WebsiteID].Scrub
+		if rules == nil {
+			continue
+		}
+
+		// Records stored before campaign parsing existed still have UTM tags only in the URL;
+		// capture them before the query string is scrubbed away
+		if pv.UTMSource == "" && pv.UTMMedium == "" && pv.UTMCampaign == "" {
+			campaign := parseCampaign(pv.PageURL)
+			pv.UTMSource, pv.UTMMedium, pv.UTMCampaign = campaign.Source, campaign.Medium, campaign.Name
+			pv.UTMTerm, pv.UTMContent = campaign.Term, campaign.Content
+		}
+		pv.PageURL = scrubURL(pv.PageURL, rules)
+		pv.Referrer = scrubURL(pv.Referrer, rules)
+
+		old := pageViews[i]
+		if pv.PageURL != old.PageURL || pv.Referrer != old.Referrer ||
+			pv.UTMSource != old.UTMSource || pv.UTMMedium != old.UTMMedium || pv.UTMCampaign != old.UTMCampaign ||
+			pv.UTMTerm != old.UTMTerm || pv.UTMContent != old.UTMContent {
+			pageViews[i] = pv
+			changed++
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("%d of %d page views would be updated\n", changed, len(pageViews))
+		return nil
+	}
+	if changed > 0 {
+		if err := writeJSONFile(pageViewsFile, pageViews); err != nil {
+			return fmt.Errorf("could not save page views: %w", err)
+		}
+	}
+	fmt.Printf("Updated %d of %d page views\n", changed, len(pageViews))
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing" // For the test runner
+)
+
+// =============================================================================
+// URL SCRUBBING TESTS
+// =============================================================================
+
+func TestScrubURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		rules *ScrubRules
+		want  string
+	}{
+		{
+			name: "nil rules leave the URL unchanged",
+			raw:  "https://example.com/reset?token=abc&email=a@b.com#top",
+			want: "https://example.com/reset?token=abc&email=a@b.com#top",
+		},
+		{
+			name:  "empty URL",
+			raw:   "",
+			rules: &ScrubRules{RedactEmails: true},
+			want:  "",
+		},
+		{
+			name:  "deny list removes matching parameters and keeps the order of the rest",
+			raw:   "https://example.com/p?b=2&token=abc&a=1",
+			rules: &ScrubRules{DenyParams: []string{"token"}},
+			want:  "https://example.com/p?b=2&a=1",
+		},
+		{
+			name:  "deny list prefix patterns are case-insensitive",
+			raw:   "https://example.com/p?Reset_Code=1&reset_token=2&page=3",
+			rules: &ScrubRules{DenyParams: []string{"RESET_*"}},
+			want:  "https://example.com/p?page=3",
+		},
+		{
+			name:  "allow list keeps only matching parameters",
+			raw:   "https://example.com/p?q=shoes&session=xyz&utm_source=news&utm_medium=email",
+			rules: &ScrubRules{AllowParams: []string{"q", "utm_*"}},
+			want:  "https://example.com/p?q=shoes&utm_source=news&utm_medium=email",
+		},
+		{
+			name:  "deny list wins over the allow list",
+			raw:   "https://example.com/p?utm_source=a&utm_id=b",
+			rules: &ScrubRules{AllowParams: []string{"utm_*"}, DenyParams: []string{"utm_id"}},
+			want:  "https://example.com/p?utm_source=a",
+		},
+		{
+			name:  "removing every parameter leaves no dangling question mark",
+			raw:   "https://example.com/p?token=abc",
+			rules: &ScrubRules{DenyParams: []string{"token"}},
+			want:  "https://example.com/p",
+		},
+		{
+			name:  "encoded parameter names are matched decoded",
+			raw:   "https://example.com/p?to%6Ben=abc&page=2",
+			rules: &ScrubRules{DenyParams: []string{"token"}},
+			want:  "https://example.com/p?page=2",
+		},
+		{
+			name:  "values are kept exactly as encoded",
+			raw:   "https://example.com/search?q=a%20b%2Bc&x=1",
+			rules: &ScrubRules{DenyParams: []string{"x"}},
+			want:  "https://example.com/search?q=a%20b%2Bc",
+		},
+		{
+			name:  "strip fragment",
+			raw:   "https://example.com/p?page=2#access_token=secret",
+			rules: &ScrubRules{StripFragment: true},
+			want:  "https://example.com/p?page=2",
+		},
+		{
+			name:  "emails are redacted in paths and queries",
+			raw:   "https://example.com/users/jane.doe@example.org/profile?ref=bob%40example.com",
+			rules: &ScrubRules{RedactEmails: true},
+			want:  "https://example.com/users/[email]/profile?ref=[email]",
+		},
+		{
+			name:  "UUIDs are redacted",
+			raw:   "https://example.com/orders/3F2504E0-4F89-11D3-9A0C-0305E82C3301?item=123e4567-e89b-12d3-a456-426614174000",
+			rules: &ScrubRules{RedactUUIDs: true},
+			want:  "https://example.com/orders/[uuid]?item=[uuid]",
+		},
+		{
+			name:  "redaction without the matching rule leaves values alone",
+			raw:   "https://example.com/u/jane@example.org",
+			rules: &ScrubRules{RedactUUIDs: true},
+			want:  "https://example.com/u/jane@example.org",
+		},
+		{
+			name:  "unparseable URLs are still redacted",
+			raw:   "%zz jane@example.org",
+			rules: &ScrubRules{RedactEmails: true},
+			want:  "%zz [email]",
+		},
+		{
+			name: "all rules together",
+			raw:  "https://example.com/reset/123e4567-e89b-12d3-a456-426614174000?email=jane@example.org&token=abc&page=1#frag",
+			rules: &ScrubRules{
+				AllowParams:   []string{"page", "email"},
+				DenyParams:    []string{"token"},
+				RedactEmails:  true,
+				RedactUUIDs:   true,
+				StripFragment: true,
+			},
+			want: "https://example.com/reset/[uuid]?email=[email]&page=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scrubURL(tt.raw, tt.rules); got != tt.want {
+				t.Errorf("scrubURL(%q)\n got  %q\n want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchParam(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{name: "token", patterns: []string{"token"}, want: true},
+		{name: "TOKEN", patterns: []string{"token"}, want: true},
+		{name: "tokens", patterns: []string{"token"}, want: false},
+		{name: "utm_source", patterns: []string{"utm_*"}, want: true},
+		{name: "utm", patterns: []string{"utm_*"}, want: false},
+		{name: "anything", patterns: []string{"*"}, want: true},
+		{name: "page", patterns: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := matchParam(tt.name, tt.patterns); got != tt.want {
+			t.Errorf("matchParam(%q, %q) = %v, want %v", tt.name, tt.patterns, got, tt.want)
+		}
+	}
+}
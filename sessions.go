@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json" // For encoding endpoint responses
+	"net/http"      // For the entry and exit page handlers
+	"sort"          // For ordering page views and report rows
+	"time"          // For session durations
+)
+
+// =============================================================================
+// SESSIONS
+// =============================================================================
+
+// session is the sequence of page views recorded for one session ID, oldest first
+type session struct {
+	ID    string
+	Views []PageView
+}
+
+// landingPage returns the first page viewed in the session
+func (s session) landingPage() string {
+	return s.Views[0].PageURL
+}
+
+// exitPage returns the last page viewed in the session
+func (s session) exitPage() string {
+	return s.Views[len(s.Views)-1].PageURL
+}
+
+// duration is the time between the first and last page view; single-page sessions last 0 seconds
+func (s session) duration() time.Duration {
+	return s.Views[len(s.Views)-1].Timestamp.Sub(s.Views[0].Timestamp)
+}
+
+// bounced reports whether the visitor left after viewing a single page
+func (s session) bounced() bool {
+	return len(s.Views) == 1
+}
+
+// groupSessions groups page views by session ID and orders each session's views by time
+// Records without a session ID (anonymous hits) cannot be grouped and are skipped.
+// Sessions are returned in order of their first page view.
+func groupSessions(pageViews []PageView) []session {
+	index := make(map[string]int)
+	var sessions []session
+	for _, pv := range pageViews {
+		if pv.SessionID == "" {
+			continue
+		}
+		i, ok := index[pv.SessionID]
+		if !ok {
+			i = len(sessions)
+			index[pv.SessionID] = i
+			sessions = append(sessions, session{ID: pv.SessionID})
+		}
+		sessions[i].Views = append(sessions[i].Views, pv)
+	}
+
+	for _, s := range sessions {
+		views := s.Views
+		sort.SliceStable(views, func(i, j int) bool {
+			return views[i].Timestamp.Before(views[j].Timestamp)
+		})
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Views[0].Timestamp.Before(sessions[j].Views[0].Timestamp)
+	})
+	return sessions
+}
+
+// SessionMetrics summarizes engagement across a set of sessions
+type SessionMetrics struct {
+	Sessions              int     `json:"sessions"`                // Number of sessions
+	BounceRate            float64 `json:"bounce_rate"`             // Percentage of sessions with a single page view
+	ViewsPerSession       float64 `json:"views_per_session"`       // Average page views per session
+	AvgSessionDuration    float64 `json:"avg_session_duration"`    // Average session duration in seconds
+	MedianSessionDuration float64 `json:"median_session_duration"` // Median session duration in seconds
+}
+
+// sessionMetrics computes bounce rate, views per session and session durations
+func sessionMetrics(sessions []session) SessionMetrics {
+	m := SessionMetrics{Sessions: len(sessions)}
+	if len(sessions) == 0 {
+		return m
+	}
+
+	bounces, views := 0, 0
+	var total time.Duration
+	durations := make([]float64, 0, len(sessions))
+	for _, s := range sessions {
+		if s.bounced() {
+			bounces++
+		}
+		views += len(s.Views)
+		total += s.duration()
+		durations = append(durations, s.duration().Seconds())
+	}
+
+	n := float64(len(sessions))
+	m.BounceRate = float64(bounces) * 100 / n
+	m.ViewsPerSession = float64(views) / n
+	m.AvgSessionDuration = total.Seconds() / n
+	m.MedianSessionDuration = median(durations)
+	return m
+}
+
+// median returns the middle value of a non-empty list, averaging the two middle values for even lengths
+// The list is sorted in place
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// LandingPageRow reports engagement for sessions that started on a page
+type LandingPageRow struct {
+	PageURL string `json:"page_url"` // Page the sessions started on
+	SessionMetrics
+	Change *Change `json:"change,omitempty"` // Change in sessions (only with ?compare)
+}
+
+// landingPages computes session metrics per landing page
+// Results are sorted by sessions and limited to the given number of rows (0 for no limit).
+func landingPages(sessions []session, limit int) []LandingPageRow {
+	byPage := make(map[string][]session)
+	for _, s := range sessions {
+		byPage[s.landingPage()] = append(byPage[s.landingPage()], s)
+	}
+
+	rows := []LandingPageRow{}
+	for page, pageSessions := range byPage {
+		rows = append(rows, LandingPageRow{PageURL: page, SessionMetrics: sessionMetrics(pageSessions)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Sessions != rows[j].Sessions {
+			return rows[i].Sessions > rows[j].Sessions
+		}
+		return rows[i].PageURL < rows[j].PageURL
+	})
+
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// =============================================================================
+// ENTRY AND EXIT PAGES
+// =============================================================================
+
+// EntryPages is the response of the /stats/{trackingId}/entry-pages endpoint
+type EntryPages struct {
+	Range DateRange        `json:"range"` // Reporting period
+	Pages []LandingPageRow `json:"pages"` // Pages sessions started on, most entries first
+}
+
+// ExitPageRow reports how often sessions ended on a page
+type ExitPageRow struct {
+	PageURL  string  `json:"page_url"`  // Page the sessions ended on
+	Exits    int     `json:"exits"`     // Sessions whose last page view was this page
+	Views    int     `json:"views"`     // All page views of this page within sessions
+	ExitRate float64 `json:"exit_rate"` // Percentage of this page's views that were the last in their session
+}
+
+// ExitPages is the response of the /stats/{trackingId}/exit-pages endpoint
+type ExitPages struct {
+	Range DateRange     `json:"range"` // Reporting period
+	Pages []ExitPageRow `json:"pages"` // Pages sessions ended on, most exits first
+}
+
+// exitPages counts the sessions ending on each page and the page's exit rate
+// Results are sorted by exits and limited to the given number of rows (0 for no limit).
+func exitPages(sessions []session, limit int) []ExitPageRow {
+	exits := make(map[string]int)
+	views := make(map[string]int)
+	for _, s := range sessions {
+		exits[s.exitPage()]++
+		for _, pv := range s.Views {
+			views[pv.PageURL]++
+		}
+	}
+
+	rows := []ExitPageRow{}
+	for page, count := range exits {
+		rows = append(rows, ExitPageRow{
+			PageURL:  page,
+			Exits:    count,
+			Views:    views[page],
+			ExitRate: float64(count) * 100 / float64(views[page]),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Exits != rows[j].Exits {
+			return rows[i].Exits > rows[j].Exits
+		}
+		return rows[i].PageURL < rows[j].PageURL
+	})
+
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// loadSessions reads the page views of the sessions selected by a report query and groups them into sessions
+func loadSessions(q reportQuery) ([]session, error) {
+	records, err := loadSessionRecords(q)
+	if err != nil {
+		return nil, err
+	}
+	return groupSessions(pageViewsOnly(records)), nil
+}
+
+// entryPagesHandler serves the pages sessions started on, with engagement metrics for each
+// Accepts the usual period, filter and limit parameters
+func entryPagesHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	limit, err := parseLimit(r, 10)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	sessions, err := loadSessions(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EntryPages{Range: query.dateRange(), Pages: landingPages(sessions, limit)})
+}
+
+// exitPagesHandler serves the pages sessions ended on, with the exit rate of each
+// Accepts the usual period, filter and limit parameters
+func exitPagesHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	limit, err := parseLimit(r, 10)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	sessions, err := loadSessions(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExitPages{Range: query.dateRange(), Pages: exitPages(sessions, limit)})
+}
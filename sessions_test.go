@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings" // For joining page lists
+	"testing" // For the test runner
+	"time"    // For session timestamps
+)
+
+// =============================================================================
+// SESSION TESTS
+// =============================================================================
+
+func TestGroupSessions(t *testing.T) {
+	start := time.Date(2026, 9, 18, 10, 0, 0, 0, time.UTC)
+	views := []PageView{
+		{SessionID: "b", PageURL: "/b2", Timestamp: start.Add(5 * time.Minute)},
+		{SessionID: "a", PageURL: "/a2", Timestamp: start.Add(3 * time.Minute)},
+		{SessionID: "b", PageURL: "/b1", Timestamp: start.Add(1 * time.Minute)},
+		{PageURL: "/anonymous", Timestamp: start}, // No session: skipped
+		{SessionID: "a", PageURL: "/a1", Timestamp: start.Add(2 * time.Minute)},
+	}
+
+	sessions := groupSessions(views)
+	var got []string
+	for _, s := range sessions {
+		var pages []string
+		for _, pv := range s.Views {
+			pages = append(pages, pv.PageURL)
+		}
+		got = append(got, s.ID+":"+strings.Join(pages, ","))
+	}
+	// Each session is in time order, and sessions are ordered by their first view
+	if want := "b:/b1,/b2 a:/a1,/a2"; strings.Join(got, " ") != want {
+		t.Errorf("groupSessions = %s, want %s", strings.Join(got, " "), want)
+	}
+	if len(groupSessions(nil)) != 0 {
+		t.Error("groupSessions of no views returned sessions")
+	}
+}
+
+func TestSessionMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []session
+		want     SessionMetrics
+	}{
+		{name: "no sessions", sessions: nil, want: SessionMetrics{}},
+		{name: "a single-view session bounces and lasts 0 seconds", sessions: []session{
+			testSession("a", funnelStep{0, "/", ""}),
+		}, want: SessionMetrics{Sessions: 1, BounceRate: 100, ViewsPerSession: 1}},
+		{name: "mixed sessions", sessions: []session{
+			testSession("a", funnelStep{0, "/", ""}),
+			testSession("b", funnelStep{0, "/", ""}, funnelStep{1, "/pricing", ""}, funnelStep{4, "/signup", ""}),
+			testSession("c", funnelStep{0, "/blog/", ""}, funnelStep{1, "/", ""}),
+			testSession("d", funnelStep{0, "/blog/", ""}, funnelStep{2, "/blog/", ""}), // A reload is a second view
+		}, want: SessionMetrics{
+			Sessions:              4,
+			BounceRate:            25,
+			ViewsPerSession:       2,
+			AvgSessionDuration:    105, // (0 + 240 + 60 + 120) / 4
+			MedianSessionDuration: 90,  // Between 60 and 120
+		}},
+	}
+	for _, tt := range tests {
+		if got := sessionMetrics(tt.sessions); got != tt.want {
+			t.Errorf("%s: sessionMetrics = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{values: []float64{7}, want: 7},
+		{values: []float64{30, 10, 20}, want: 20},
+		{values: []float64{40, 10, 30, 20}, want: 25},
+		{values: []float64{0, 0, 600}, want: 0}, // Bounces pull the median down, unlike the average
+	}
+	for _, tt := range tests {
+		if got := median(append([]float64(nil), tt.values...)); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestLandingPages(t *testing.T) {
+	sessions := []session{
+		testSession("a", funnelStep{0, "/", ""}),
+		testSession("b", funnelStep{0, "/", ""}, funnelStep{2, "/pricing", ""}),
+		testSession("c", funnelStep{0, "/blog/", ""}, funnelStep{1, "/", ""}),
+		testSession("d", funnelStep{0, "/pricing", ""}),
+	}
+
+	rows := landingPages(sessions, 0)
+	want := []LandingPageRow{
+		{PageURL: "https://example.com/", SessionMetrics: SessionMetrics{Sessions: 2, BounceRate: 50, ViewsPerSession: 1.5, AvgSessionDuration: 60, MedianSessionDuration: 60}},
+		// Ties are ordered by page
+		{PageURL: "https://example.com/blog/", SessionMetrics: SessionMetrics{Sessions: 1, BounceRate: 0, ViewsPerSession: 2, AvgSessionDuration: 60, MedianSessionDuration: 60}},
+		{PageURL: "https://example.com/pricing", SessionMetrics: SessionMetrics{Sessions: 1, BounceRate: 100, ViewsPerSession: 1}},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("landingPages = %+v, want %d rows", rows, len(want))
+	}
+	for i := range want {
+		if rows[i].PageURL != want[i].PageURL || rows[i].SessionMetrics != want[i].SessionMetrics {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	if rows := landingPages(sessions, 1); len(rows) != 1 || rows[0].PageURL != "https://example.com/" {
+		t.Errorf("landingPages with limit 1 = %+v", rows)
+	}
+	if rows := landingPages(nil, 10); rows == nil || len(rows) != 0 {
+		t.Errorf("landingPages of no sessions = %#v, want an empty list", rows)
+	}
+}
+
+func TestSessionRecords(t *testing.T) {
+	all := []PageView{
+		{ID: "1", SessionID: "s1", PageURL: "https://example.com/pricing"},
+		{ID: "2", SessionID: "s1", PageURL: "https://example.com/signup"},
+		{ID: "3", SessionID: "s2", PageURL: "https://example.com/blog/"},
+		{ID: "4", PageURL: "https://example.com/pricing"},
+	}
+	filters, _ := parseFilters([]string{"page==/pricing"})
+	matched := applyFilters(all, filters, Website{})
+
+	// A matching record selects its whole session; anonymous records cannot form sessions
+	if got := keptIDs(sessionRecords(all, matched)); got != "1,2" {
+		t.Errorf("sessionRecords with a page filter = %s, want 1,2", got)
+	}
+	// Unfiltered, everything is kept, anonymous records included
+	if got := keptIDs(sessionRecords(all, all)); got != "1,2,3,4" {
+		t.Errorf("sessionRecords without filters = %s, want 1,2,3,4", got)
+	}
+}
+
+// =============================================================================
+// EXIT PAGE TESTS
+// =============================================================================
+
+func TestExitPages(t *testing.T) {
+	sessions := []session{
+		testSession("a", funnelStep{0, "/", ""}), // A bounce exits from its only page
+		testSession("b", funnelStep{0, "/", ""}, funnelStep{1, "/pricing", ""}, funnelStep{2, "/", ""}),
+		testSession("c", funnelStep{0, "/pricing", ""}, funnelStep{1, "/signup", ""}),
+		testSession("d", funnelStep{0, "/pricing", ""}),
+	}
+
+	rows := exitPages(sessions, 0)
+	want := []ExitPageRow{
+		// "/" was viewed three times (twice in b) and was the last page twice
+		{PageURL: "https://example.com/", Exits: 2, Views: 3, ExitRate: 200.0 / 3},
+		// Ties are ordered by page
+		{PageURL: "https://example.com/pricing", Exits: 1, Views: 3, ExitRate: 100.0 / 3},
+		{PageURL: "https://example.com/signup", Exits: 1, Views: 1, ExitRate: 100},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("exitPages = %+v, want %d rows", rows, len(want))
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	// Pages that were viewed but never last do not appear
+	for _, row := range exitPages(sessions[1:2], 0) {
+		if row.PageURL == "https://example.com/pricing" {
+			t.Error("a page in the middle of a session was reported as an exit")
+		}
+	}
+	if rows := exitPages(sessions, 2); len(rows) != 2 {
+		t.Errorf("exitPages with limit 2 returned %d rows", len(rows))
+	}
+	if rows := exitPages(nil, 10); rows == nil || len(rows) != 0 {
+		t.Errorf("exitPages of no sessions = %#v, want an empty list", rows)
+	}
+}
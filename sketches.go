@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json" // For encoding the response
+	"errors"        // For detecting missing sketch files
+	"flag"          // For parsing command flags
+	"fmt"           // For error formatting and command output
+	"log"           // For reporting the initial backfill
+	"net/http"      // For the uniques handler
+	"net/url"       // For escaping website IDs in directory names
+	"os"            // For listing and removing day files
+	"path/filepath" // For building sketch file paths
+	"sort"          // For ordering breakdown rows
+	"strings"       // For splitting sketch keys
+	"sync"          // For serializing sketch updates
+	"time"          // For iterating over days
+)
+
+// =============================================================================
+// UNIQUE COUNT SKETCHES
+// =============================================================================
+
+// sketchesDir holds HyperLogLog sketches of session and visitor IDs, one file per website and day:
+// data/sketches/<website ID>/<YYYY-MM-DD>.json. Unlike pageviews.json they are not capped, so unique
+// counts stay available for old periods, while recording a hit only rewrites the current day's file.
+var sketchesDir = filepath.Join(dataDir, "sketches")
+
+// sketchMutex serializes read-modify-write cycles on sketch files so concurrent hits are not lost
+var sketchMutex sync.Mutex
+
+// sketchedDimensions are the dimensions with per-value sketches, in addition to the daily totals
+var sketchedDimensions = []string{
+	"page", "source", "channel", "browser", "os", "device", "country",
+	"utm_source", "utm_medium", "utm_campaign",
+}
+
+// sketchPair holds the session and visitor sketches for one day and dimension value
+type sketchPair struct {
+	Sessions *hyperLogLog `json:"sessions"`
+	Visitors *hyperLogLog `json:"visitors"`
+}
+
+// daySketches holds one website's sketches for one day (in the website's time zone)
+// The key is "" for the day's totals and "<dimension>=<value>" for a dimension value
+type daySketches map[string]*sketchPair
+
+// sketchKey builds the key for a dimension value
+func sketchKey(dimension, value string) string {
+	return dimension + "=" + value
+}
+
+// sketched reports whether a record is counted in the sketches
+// Custom events and anonymous hits (no IDs) are skipped, matching the exact counts in /stats
+func sketched(pv PageView) bool {
+	return isPageView(pv) && (pv.SessionID != "" || pv.VisitorID != "")
+}
+
+// sketchDay returns the day a record is sketched under, in the website's time zone
+func sketchDay(pv PageView, website Website) string {
+	return pv.Timestamp.In(websiteLocation(website)).Format("2006-01-02")
+}
+
+// add records a page view's session and visitor IDs under the day's totals and each dimension value
+func (s daySketches) add(pv PageView, website Website) {
+	keys := []string{""}
+	for _, dimension := range sketchedDimensions {
+		if value := dimensionValue(pv, dimension, website); value != "" {
+			keys = append(keys, sketchKey(dimension, value))
+		}
+	}
+	for _, key := range keys {
+		pair := s[key]
+		if pair == nil {
+			pair = &sketchPair{Sessions: newHLL(), Visitors: newHLL()}
+			s[key] = pair
+		}
+		if pv.SessionID != "" {
+			pair.Sessions.add(pv.SessionID)
+		}
+		if pv.VisitorID != "" {
+			pair.Visitors.add(pv.VisitorID)
+		}
+	}
+}
+
+// sketchWebsiteDir returns the directory holding a website's day files
+// Website IDs are escaped so they cannot name another directory (e.g. "..")
+func sketchWebsiteDir(websiteID string) string {
+	return filepath.Join(sketchesDir, strings.ReplaceAll(url.PathEscape(websiteID), ".", "%2E"))
+}
+
+// sketchFile returns the path of a website's sketches for one day
+func sketchFile(websiteID, day string) string {
+	return filepath.Join(sketchWebsiteDir(websiteID), day+".json")
+}
+
+// readDaySketches loads a website's sketches for one day, treating a missing file as empty
+func readDaySketches(websiteID, day string) (daySketches, error) {
+	sketches := daySketches{}
+	if err := readJSONFile(sketchFile(websiteID, day), &sketches); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return sketches, nil
+}
+
+// writeDaySketches saves a website's sketches for one day
+func writeDaySketches(websiteID, day string, sketches daySketches) error {
+	if err := os.MkdirAll(sketchWebsiteDir(websiteID), 0700); err != nil {
+		return err
+	}
+	return writeJSONFile(sketchFile(websiteID, day), sketches)
+}
+
+// sketchDays lists the days a website has sketches for
+func sketchDays(websiteID string) ([]string, error) {
+	entries, err := os.ReadDir(sketchWebsiteDir(websiteID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, entry := range entries {
+		if day, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// recordSketch adds a newly tracked page view to its day's sketches
+func recordSketch(pv PageView, website Website) error {
+	if !sketched(pv) {
+		return nil
+	}
+	sketchMutex.Lock()
+	defer sketchMutex.Unlock()
+	day := sketchDay(pv, website)
+	sketches, err := readDaySketches(pv.WebsiteID, day)
+	if err != nil {
+		return err
+	}
+	sketches.add(pv, website)
+	return writeDaySketches(pv.WebsiteID, day, sketches)
+}
+
+// rebuildSketches recomputes the sketches of the given websites ("" for all) from the stored page views
+// With keepHistory, days before a website's oldest stored page view are kept, since the page view
+// file is capped and those days can no longer be rebuilt. Otherwise all of the website's sketches are replaced.
+func rebuildSketches(pageViews []PageView, websites map[string]Website, websiteID string, keepHistory bool) error {
+	sketchMutex.Lock()
+	defer sketchMutex.Unlock()
+
+	// Build fresh sketches per website and day, noting the first day covered by stored page views
+	built := make(map[string]map[string]daySketches)
+	firstDay := make(map[string]string)
+	for _, pv := range pageViews {
+		if websiteID != "" && pv.WebsiteID != websiteID {
+			continue
+		}
+		website := websites[pv.WebsiteID]
+		day := sketchDay(pv, website)
+		if first, ok := firstDay[pv.WebsiteID]; !ok || day < first {
+			firstDay[pv.WebsiteID] = day
+		}
+		if !sketched(pv) {
+			continue
+		}
+		if built[pv.WebsiteID] == nil {
+			built[pv.WebsiteID] = make(map[string]daySketches)
+		}
+		if built[pv.WebsiteID][day] == nil {
+			built[pv.WebsiteID][day] = daySketches{}
+		}
+		built[pv.WebsiteID][day].add(pv, website)
+	}
+
+	// Rebuild every website with stored page views or existing sketches
+	ids := []string{websiteID}
+	if websiteID == "" {
+		ids = ids[:0]
+		for id := range firstDay {
+			ids = append(ids, id)
+		}
+		entries, err := os.ReadDir(sketchesDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, entry := range entries {
+			id, err := url.PathUnescape(entry.Name())
+			if err == nil && entry.IsDir() && firstDay[id] == "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		days, err := sketchDays(id)
+		if err != nil {
+			return err
+		}
+		first, covered := firstDay[id]
+		for _, day := range days {
+			if !keepHistory || (covered && day >= first) {
+				if err := os.Remove(sketchFile(id, day)); err != nil {
+					return err
+				}
+			}
+		}
+		for day, sketches := range built[id] {
+			if err := writeDaySketches(id, day, sketches); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillSketches builds the sketches from the stored page views when none exist yet,
+// e.g. on the first start after upgrading, so unique counts cover existing data without a manual rebuild
+func backfillSketches() error {
+	if _, err := os.Stat(sketchesDir); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	websites, err := loadWebsiteMap()
+	if err != nil {
+		return fmt.Errorf("could not read websites: %w", err)
+	}
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return fmt.Errorf("could not read page views: %w", err)
+	}
+	if err := os.MkdirAll(sketchesDir, 0700); err != nil {
+		return err
+	}
+	if err := rebuildSketches(pageViews, websites, "", true); err != nil {
+		return err
+	}
+	log.Printf("Built unique count sketches from %d stored page views", len(pageViews))
+	return nil
+}
+
+// runRebuildSketches recomputes unique count sketches from pageviews.json
+func runRebuildSketches(args []string) error {
+	flags := flag.NewFlagSet("rebuild-sketches", flag.ContinueOnError)
+	websiteID := flags.String("website", "", "only rebuild sketches for this website ID")
+	discardHistory := flags.Bool("discard-history", false, "also drop sketches for days older than the stored page views")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	websites, err := loadWebsiteMap()
+	if err != nil {
+		return fmt.Errorf("could not read websites: %w", err)
+	}
+	var pageViews []PageView
+	if err := readJSONFile(pageViewsFile, &pageViews); err != nil {
+		return fmt.Errorf("could not read page views: %w", err)
+	}
+	if err := rebuildSketches(pageViews, websites, *websiteID, !*discardHistory); err != nil {
+		return fmt.Errorf("could not rebuild sketches: %w", err)
+	}
+	fmt.Printf("Rebuilt sketches from %d page views\n", len(pageViews))
+	return nil
+}
+
+// Uniques is the response of the /stats/{trackingId}/uniques endpoint
+type Uniques struct {
+	Range         DateRange    `json:"range"`               // Reporting period
+	Sessions      uint64       `json:"sessions"`            // Estimated unique sessions in the period
+	Visitors      uint64       `json:"visitors"`            // Estimated unique visitor IDs in the period
+	StandardError float64      `json:"standard_error"`      // Relative standard error of each estimate (0.016 = 1.6%)
+	Dimension     string       `json:"dimension,omitempty"` // Dimension broken down (only with ?dimension)
+	Breakdown     []UniquesRow `json:"breakdown,omitempty"` // Estimates per dimension value, most sessions first
+}
+
+// UniquesRow holds the estimates for one dimension value
+type UniquesRow struct {
+	Name     string `json:"name"`
+	Sessions uint64 `json:"sessions"`
+	Visitors uint64 `json:"visitors"`
+}
+
+// mergeSketches merges a website's sketches for every day in [start, end), keyed like a single day
+// Only keys accepted by keep are merged (nil keeps every key)
+func mergeSketches(websiteID string, start, end time.Time, keep func(key string) bool) (daySketches, error) {
+	merged := daySketches{}
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		sketches, err := readDaySketches(websiteID, day.Format("2006-01-02"))
+		if err != nil {
+			return nil, err
+		}
+		for key, pair := range sketches {
+			if keep != nil && !keep(key) {
+				continue
+			}
+			if merged[key] == nil {
+				merged[key] = &sketchPair{Sessions: newHLL(), Visitors: newHLL()}
+			}
+			merged[key].Sessions.merge(pair.Sessions)
+			merged[key].Visitors.merge(pair.Visitors)
+		}
+	}
+	return merged, nil
+}
+
+// estimateUniques estimates a query's unique sessions and visitors from the day sketches
+// It reports false when sketches cannot answer the query exactly as asked: filtered queries,
+// and ranges that do not cover whole days (e.g. the comparison range of a period in progress).
+func estimateUniques(q reportQuery) (sessions, visitors int, ok bool, err error) {
+	wholeDays := func(t time.Time) bool {
+		t = t.In(q.Location)
+		return t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, q.Location))
+	}
+	if len(q.Filters) > 0 || !wholeDays(q.Start) || !wholeDays(q.End) {
+		return 0, 0, false, nil
+	}
+	merged, err := mergeSketches(q.Website.ID, q.Start, q.End, func(key string) bool { return key == "" })
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if total := merged[""]; total != nil {
+		sessions, visitors = int(total.Sessions.count()), int(total.Visitors.count())
+	}
+	return sessions, visitors, true, nil
+}
+
+// uniquesHandler estimates unique sessions and visitors over any period from the stored sketches
+// Accepts the usual period parameters plus dimension=<one of sketchedDimensions> and limit.
+// Filters are not supported, since sketches are aggregated in advance.
+func uniquesHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if len(query.Filters) > 0 {
+		writeQueryError(w, badQuery("filters are not supported for sketch-based unique counts; use /stats instead"))
+		return
+	}
+	dimension := r.URL.Query().Get("dimension")
+	if dimension != "" && !containsString(sketchedDimensions, dimension) {
+		writeQueryError(w, badQuery("dimension %q has no sketches: use one of %s", dimension, strings.Join(sketchedDimensions, ", ")))
+		return
+	}
+	limit, err := parseLimit(r, 10)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	merged, err := mergeSketches(query.Website.ID, query.Start, query.End, nil)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	response := Uniques{Range: query.dateRange(), StandardError: hllStandardError}
+	if total := merged[""]; total != nil {
+		response.Sessions, response.Visitors = total.Sessions.count(), total.Visitors.count()
+	}
+	if dimension != "" {
+		response.Dimension = dimension
+		response.Breakdown = []UniquesRow{}
+		prefix := sketchKey(dimension, "")
+		for key, pair := range merged {
+			if name, ok := strings.CutPrefix(key, prefix); ok {
+				response.Breakdown = append(response.Breakdown, UniquesRow{
+					Name:     name,
+					Sessions: pair.Sessions.count(),
+					Visitors: pair.Visitors.count(),
+				})
+			}
+		}
+		sort.Slice(response.Breakdown, func(i, j int) bool {
+			a, b := response.Breakdown[i], response.Breakdown[j]
+			if a.Sessions != b.Sessions {
+				return a.Sessions > b.Sessions
+			}
+			return a.Name < b.Name
+		})
+		if len(response.Breakdown) > limit {
+			response.Breakdown = response.Breakdown[:limit]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// containsString reports whether a list contains a value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json" // For decoding handler responses
+	"net/http"      // For status codes
+	"path/filepath" // For the temporary sketch directory
+	"strconv"       // For formatting estimates
+	"strings"       // For comparing day lists
+	"testing"       // For the test runner
+	"time"          // For page view timestamps
+)
+
+// =============================================================================
+// TEST HELPERS
+// =============================================================================
+
+// useTempSketches points the sketch directory at a temporary directory for one test
+func useTempSketches(t *testing.T) {
+	t.Helper()
+	useTestKeys(t)
+	previous := sketchesDir
+	t.Cleanup(func() { sketchesDir = previous })
+	sketchesDir = filepath.Join(t.TempDir(), "sketches")
+}
+
+// sketchView is a page view of a session and visitor at a time in UTC
+func sketchView(t *testing.T, websiteID, sessionID, visitorID, when string) PageView {
+	return PageView{
+		WebsiteID: websiteID, SessionID: sessionID, VisitorID: visitorID,
+		PageURL: "https://example.com/", Timestamp: at(t, when, time.UTC),
+	}
+}
+
+// sketchedSessions returns the estimated sessions under a key of a website's day file, 0 if there are none
+func sketchedSessions(t *testing.T, websiteID, day, key string) uint64 {
+	t.Helper()
+	sketches, err := readDaySketches(websiteID, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair := sketches[key]; pair != nil {
+		return pair.Sessions.count()
+	}
+	return 0
+}
+
+// listSketchDays lists a website's sketched days, e.g. "2026-03-01,2026-03-02"
+func listSketchDays(t *testing.T, websiteID string) string {
+	t.Helper()
+	days, err := sketchDays(websiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(days, ",")
+}
+
+// =============================================================================
+// SKETCH RECORDING TESTS
+// =============================================================================
+
+func TestRecordSketch(t *testing.T) {
+	useTempSketches(t)
+	website := Website{ID: "site", Domain: "example.com", Timezone: "America/New_York"}
+	pricing := PageView{WebsiteID: "site", SessionID: "s1", VisitorID: "v1", PageURL: "https://example.com/pricing", Country: "DE",
+		Timestamp: time.Date(2026, 3, 3, 3, 0, 0, 0, time.UTC)} // 2 March in New York
+
+	for _, pv := range []PageView{
+		pricing,
+		pricing, // The same session again
+		{WebsiteID: "site", SessionID: "s2", VisitorID: "v1", PageURL: "https://example.com/", Timestamp: pricing.Timestamp},
+		// Custom events and anonymous hits are not sketched
+		{WebsiteID: "site", SessionID: "s3", VisitorID: "v3", PageURL: "https://example.com/", Event: "signup", Timestamp: pricing.Timestamp},
+		{WebsiteID: "site", PageURL: "https://example.com/", Timestamp: pricing.Timestamp},
+	} {
+		if err := recordSketch(pv, website); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if days := listSketchDays(t, "site"); days != "2026-03-02" {
+		t.Fatalf("sketched days = %s, want the day in the website's time zone", days)
+	}
+	sketches, _ := readDaySketches("site", "2026-03-02")
+	if total := sketches[""]; total.Sessions.count() != 2 || total.Visitors.count() != 1 {
+		t.Errorf("day totals = %d sessions, %d visitors; want 2, 1", total.Sessions.count(), total.Visitors.count())
+	}
+	for key, want := range map[string]uint64{"page=/pricing": 1, "page=/": 1, "country=DE": 1, "browser=": 0} {
+		if got := sketchedSessions(t, "site", "2026-03-02", key); got != want {
+			t.Errorf("%s: %d sessions, want %d", key, got, want)
+		}
+	}
+}
+
+// =============================================================================
+// SKETCH REBUILD TESTS
+// =============================================================================
+
+func TestRebuildSketches(t *testing.T) {
+	websites := map[string]Website{"site": {ID: "site"}, "other": {ID: "other"}}
+	pageViews := []PageView{
+		sketchView(t, "site", "s1", "v1", "2026-03-02 10:00"),
+		sketchView(t, "site", "s2", "v2", "2026-03-02 11:00"),
+		sketchView(t, "site", "s3", "v1", "2026-03-03 10:00"),
+		{WebsiteID: "site", SessionID: "s4", Event: "signup", Timestamp: at(t, "2026-03-04 10:00", time.UTC)},
+	}
+
+	tests := []struct {
+		name        string
+		websiteID   string
+		keepHistory bool
+		site        string // Days left for site
+		other       string // Days left for other
+	}{
+		// 03-01 predates the stored page views and is kept; 03-04 only has an event; 03-05 is covered but now empty
+		{name: "keep history", keepHistory: true, site: "2026-03-01,2026-03-02,2026-03-03", other: "2026-03-01"},
+		{name: "discard history", keepHistory: false, site: "2026-03-02,2026-03-03", other: ""},
+		{name: "one website", websiteID: "site", keepHistory: false, site: "2026-03-02,2026-03-03", other: "2026-03-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempSketches(t)
+			// Existing sketches: an old day, a stale covered day, and a website without stored page views
+			for _, pv := range []PageView{
+				sketchView(t, "site", "old", "old", "2026-03-01 10:00"),
+				sketchView(t, "site", "stale", "stale", "2026-03-02 12:00"),
+				sketchView(t, "site", "stale", "stale", "2026-03-05 10:00"),
+				sketchView(t, "other", "o1", "o1", "2026-03-01 10:00"),
+			} {
+				if err := recordSketch(pv, websites[pv.WebsiteID]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := rebuildSketches(pageViews, websites, tt.websiteID, tt.keepHistory); err != nil {
+				t.Fatal(err)
+			}
+			if days := listSketchDays(t, "site"); days != tt.site {
+				t.Errorf("site days = %q, want %q", days, tt.site)
+			}
+			if days := listSketchDays(t, "other"); days != tt.other {
+				t.Errorf("other days = %q, want %q", days, tt.other)
+			}
+			// Rebuilt days hold the stored page views only, not what was sketched before
+			if got := sketchedSessions(t, "site", "2026-03-02", ""); got != 2 {
+				t.Errorf("rebuilt 2026-03-02: %d sessions, want 2", got)
+			}
+			if tt.keepHistory {
+				if got := sketchedSessions(t, "site", "2026-03-01", ""); got != 1 {
+					t.Errorf("kept 2026-03-01: %d sessions, want 1", got)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteSubjectRebuildsSketches(t *testing.T) {
+	now := time.Now().UTC()
+	website := Website{ID: "site", Domain: "example.com"}
+	views := []PageView{
+		{WebsiteID: "site", SessionID: "s1", VisitorID: "v1", PageURL: "https://example.com/", Timestamp: now},
+		{WebsiteID: "site", SessionID: "s2", VisitorID: "v2", PageURL: "https://example.com/", Timestamp: now},
+		{WebsiteID: "site", SessionID: "s2", VisitorID: "v2", PageURL: "https://example.com/pricing", Timestamp: now},
+	}
+	useTestSite(t, []Website{website}, views)
+	useTempSketches(t)
+	for _, pv := range views {
+		if err := recordSketch(pv, website); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if deleted, err := deleteSubject(SubjectQuery{SessionID: "s2"}); err != nil || deleted != 2 {
+		t.Fatalf("deleteSubject = %d, %v; want 2 deleted", deleted, err)
+	}
+	// The erased session's IDs no longer count in any of the day's sketches
+	day := sketchDay(views[0], website)
+	for key, want := range map[string]uint64{"": 1, "page=/": 1, "page=/pricing": 0} {
+		if got := sketchedSessions(t, "site", day, key); got != want {
+			t.Errorf("after deletion, %q: %d sessions, want %d", key, got, want)
+		}
+	}
+}
+
+// =============================================================================
+// UNIQUE ESTIMATE TESTS
+// =============================================================================
+
+func TestEstimateUniques(t *testing.T) {
+	useTempSketches(t)
+	newYork := mustLocation(t, "America/New_York")
+	website := Website{ID: "site", Timezone: "America/New_York"}
+	// s2 continues over midnight, and v1 returns the next day with a new session
+	for _, pv := range []PageView{
+		{WebsiteID: "site", SessionID: "s1", VisitorID: "v1", Timestamp: at(t, "2026-03-02 09:00", newYork)},
+		{WebsiteID: "site", SessionID: "s2", VisitorID: "v1", Timestamp: at(t, "2026-03-02 23:50", newYork)},
+		{WebsiteID: "site", SessionID: "s2", VisitorID: "v1", Timestamp: at(t, "2026-03-03 00:10", newYork)},
+		{WebsiteID: "site", SessionID: "s3", VisitorID: "v2", Timestamp: at(t, "2026-03-03 12:00", newYork)},
+		{WebsiteID: "site", SessionID: "s4", VisitorID: "v3", Timestamp: at(t, "2026-03-04 12:00", newYork)},
+	} {
+		if err := recordSketch(pv, website); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filters, _ := parseFilters([]string{"page==/"})
+
+	tests := []struct {
+		name     string
+		from, to string
+		start    time.Time // Overrides the start of the range when set
+		filters  []Filter
+		sessions int
+		visitors int
+		ok       bool
+	}{
+		{name: "one day", from: "2026-03-02", to: "2026-03-02", sessions: 2, visitors: 1, ok: true},
+		{name: "days are merged, not summed", from: "2026-03-02", to: "2026-03-03", sessions: 3, visitors: 2, ok: true},
+		{name: "three days", from: "2026-03-01", to: "2026-03-04", sessions: 4, visitors: 3, ok: true},
+		{name: "no sketches", from: "2025-01-01", to: "2025-01-31", sessions: 0, visitors: 0, ok: true},
+		{name: "filtered", from: "2026-03-02", to: "2026-03-03", filters: filters},
+		{name: "partial day", from: "2026-03-02", to: "2026-03-03", start: at(t, "2026-03-02 12:00", newYork)},
+	}
+	for _, tt := range tests {
+		start, end, err := periodRange("custom", tt.from, tt.to, time.Now(), newYork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tt.start.IsZero() {
+			start = tt.start
+		}
+		q := reportQuery{Website: website, Location: newYork, Start: start, End: end, Filters: tt.filters}
+		sessions, visitors, ok, err := estimateUniques(q)
+		if err != nil || sessions != tt.sessions || visitors != tt.visitors || ok != tt.ok {
+			t.Errorf("%s: estimateUniques = %d, %d, %v, %v; want %d, %d, %v",
+				tt.name, sessions, visitors, ok, err, tt.sessions, tt.visitors, tt.ok)
+		}
+	}
+}
+
+func TestUniquesHandler(t *testing.T) {
+	now := time.Now().UTC()
+	website := Website{ID: "site", Domain: "example.com"}
+	view := func(session, visitor, page, country string) PageView {
+		return PageView{WebsiteID: "site", SessionID: session, VisitorID: visitor, PageURL: "https://example.com" + page, Country: country, Timestamp: now}
+	}
+	views := []PageView{
+		view("s1", "v1", "/pricing", "DE"),
+		view("s1", "v1", "/", "DE"),
+		view("s2", "v1", "/pricing", "DE"),
+		view("s3", "v2", "/pricing", "FR"),
+	}
+	useTestSite(t, []Website{website}, views)
+	useTempSketches(t)
+	for _, pv := range views {
+		if err := recordSketch(pv, website); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, want := range map[string]int{
+		"":                       http.StatusOK,
+		"dimension=page":         http.StatusOK,
+		"dimension=title":        http.StatusBadRequest, // Not sketched
+		"filter=page==/":         http.StatusBadRequest,
+		"dimension=page&limit=0": http.StatusBadRequest,
+	} {
+		if w := serveStats(uniquesHandler, "site", query); w.Code != want {
+			t.Errorf("uniques?%s: status %d, want %d (%s)", query, w.Code, want, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  string // "name sessions/visitors" rows, most sessions first
+	}{
+		{query: "dimension=page", want: "/pricing 3/2,/ 1/1"},
+		{query: "dimension=page&limit=1", want: "/pricing 3/2"},
+		{query: "dimension=country", want: "DE 2/1,FR 1/1"},
+		{query: "dimension=utm_source", want: ""},
+	}
+	for _, tt := range tests {
+		var uniques Uniques
+		w := serveStats(uniquesHandler, "site", tt.query)
+		if err := json.Unmarshal(w.Body.Bytes(), &uniques); err != nil {
+			t.Fatalf("uniques?%s: %v", tt.query, err)
+		}
+		if uniques.Sessions != 3 || uniques.Visitors != 2 {
+			t.Errorf("uniques?%s: totals %d sessions, %d visitors; want 3, 2", tt.query, uniques.Sessions, uniques.Visitors)
+		}
+		rows := make([]string, len(uniques.Breakdown))
+		for i, row := range uniques.Breakdown {
+			rows[i] = row.Name + " " + strconv.FormatUint(row.Sessions, 10) + "/" + strconv.FormatUint(row.Visitors, 10)
+		}
+		if got := strings.Join(rows, ","); got != tt.want {
+			t.Errorf("uniques?%s: breakdown %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
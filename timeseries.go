@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json" // For encoding the response
+	"net/http"      // For the HTTP handler
+	"time"          // For bucketing timestamps
+)
+
+// =============================================================================
+// TIME SERIES
+// =============================================================================
+
+// maxTimeSeriesPoints caps the number of buckets so an hourly query over years cannot exhaust memory
+const maxTimeSeriesPoints = 10000
+
+// TimeSeries is the response of the /stats/{trackingId}/timeseries endpoint
+type TimeSeries struct {
+	Range    DateRange         `json:"range"`    // Reporting period
+	Interval string            `json:"interval"` // Bucket size: hour, day, week or month
+	Points   []TimeSeriesPoint `json:"points"`   // One point per bucket, including empty ones
+
+	// Compare and Previous hold the comparison period and its points (only with ?compare=previous|year)
+	Compare  *DateRange        `json:"compare,omitempty"`
+	Previous []TimeSeriesPoint `json:"previous,omitempty"`
+}
+
+// TimeSeriesPoint holds the metrics for a single bucket
+type TimeSeriesPoint struct {
+	Date     string `json:"date"`     // Bucket start: RFC 3339 for hours, YYYY-MM-DD for days and weeks, YYYY-MM for months
+	Views    int    `json:"views"`    // Page views in the bucket
+	Sessions int    `json:"sessions"` // Unique sessions in the bucket
+	Visitors int    `json:"visitors"` // Unique visitors in the bucket
+}
+
+// bucketStart truncates a timestamp to the start of its bucket in the reporting time zone
+// Weeks start on Monday
+func bucketStart(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch interval {
+	case "hour":
+		// Subtract rather than rebuild from the wall clock: when clocks go back, 01:00-02:00 happens
+		// twice and time.Date would map both hours to the first one
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket returns the start of the bucket after the one starting at t
+// Calendar arithmetic keeps days, weeks and months aligned across DST changes
+func nextBucket(t time.Time, interval string, loc *time.Location) time.Time {
+	switch interval {
+	case "hour":
+		return bucketStart(t.Add(time.Hour), interval, loc)
+	case "week":
+		return time.Date(t.Year(), t.Month(), t.Day()+7, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+	}
+}
+
+// bucketLabel formats a bucket start for the response
+func bucketLabel(t time.Time, interval string) string {
+	switch interval {
+	case "hour":
+		return t.Format(time.RFC3339)
+	case "month":
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// buildTimeSeries buckets page views by interval, emitting a zero point for every empty bucket in the range
+func buildTimeSeries(pageViews []PageView, q reportQuery, interval string) ([]TimeSeriesPoint, error) {
+	type bucket struct {
+		views    int
+		sessions map[string]bool
+		visitors map[string]bool
+	}
+	buckets := make(map[time.Time]*bucket)
+	for _, pv := range pageViews {
+		start := bucketStart(pv.Timestamp, interval, q.Location)
+		b := buckets[start]
+		if b == nil {
+			b = &bucket{sessions: make(map[string]bool), visitors: make(map[string]bool)}
+			buckets[start] = b
+		}
+		b.views++
+		if pv.SessionID != "" {
+			b.sessions[pv.SessionID] = true
+		}
+		if pv.VisitorID != "" {
+			b.visitors[pv.VisitorID] = true
+		}
+	}
+
+	points := []TimeSeriesPoint{}
+	for t := bucketStart(q.Start, interval, q.Location); t.Before(q.End); t = nextBucket(t, interval, q.Location) {
+		if len(points) >= maxTimeSeriesPoints {
+			return nil, badQuery("too many %s buckets in this range; use a larger interval", interval)
+		}
+		point := TimeSeriesPoint{Date: bucketLabel(t, interval)}
+		if b := buckets[t]; b != nil {
+			point.Views = b.views
+			point.Sessions = len(b.sessions)
+			point.Visitors = len(b.visitors)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// timeseriesHandler serves views, sessions and visitors per time bucket for graphing
+// Accepts the usual period/from/to parameters plus interval=hour|day|week|month
+// (default hour for period=today, day otherwise)
+func timeseriesHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseReportQuery(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+		if query.Period == "today" {
+			interval = "hour"
+		}
+	}
+	if interval != "hour" && interval != "day" && interval != "week" && interval != "month" {
+		writeQueryError(w, badQuery("unknown interval %q: use hour, day, week or month", interval))
+		return
+	}
+
+	pageViews, err := loadReportViews(query)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	points, err := buildTimeSeries(pageViewsOnly(pageViews), query, interval)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	series := TimeSeries{Range: query.dateRange(), Interval: interval, Points: points}
+
+	// Previous points line up with the current ones by position for overlaying on a chart
+	if previousQuery, ok := query.comparison(); ok {
+		previousViews, err := loadReportViews(previousQuery)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		series.Previous, err = buildTimeSeries(pageViewsOnly(previousViews), previousQuery, interval)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		compareRange := previousQuery.dateRange()
+		series.Compare = &compareRange
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
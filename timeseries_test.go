@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"  // For classifying query errors
+	"testing" // For the test runner
+	"time"    // For building test ranges
+)
+
+// =============================================================================
+// TIME SERIES TESTS
+// =============================================================================
+
+func TestBuildTimeSeriesBuckets(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+
+	tests := []struct {
+		name       string
+		from, to   string
+		interval   string
+		wantPoints int
+		wantFirst  string
+		wantLast   string
+	}{
+		// Clocks go forward at 02:00 on 8 March 2026: the day has 23 hours
+		{name: "hours on the spring DST change", from: "2026-03-08", to: "2026-03-08", interval: "hour",
+			wantPoints: 23, wantFirst: "2026-03-08T00:00:00-05:00", wantLast: "2026-03-08T23:00:00-04:00"},
+		// Clocks go back at 02:00 on 1 November 2026: 01:00-02:00 happens twice, giving 25 hours
+		{name: "hours on the autumn DST change", from: "2026-11-01", to: "2026-11-01", interval: "hour",
+			wantPoints: 25, wantFirst: "2026-11-01T00:00:00-04:00", wantLast: "2026-11-01T23:00:00-05:00"},
+		{name: "days across the DST change", from: "2026-03-06", to: "2026-03-10", interval: "day",
+			wantPoints: 5, wantFirst: "2026-03-06", wantLast: "2026-03-10"},
+		{name: "days across a month boundary", from: "2026-01-30", to: "2026-02-02", interval: "day",
+			wantPoints: 4, wantFirst: "2026-01-30", wantLast: "2026-02-02"},
+		// 1 March 2026 is a Sunday, so its week starts on Monday 23 February
+		{name: "weeks start on Monday", from: "2026-03-01", to: "2026-03-16", interval: "week",
+			wantPoints: 4, wantFirst: "2026-02-23", wantLast: "2026-03-16"},
+		{name: "months", from: "2026-01-31", to: "2026-04-01", interval: "month",
+			wantPoints: 4, wantFirst: "2026-01", wantLast: "2026-04"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := periodRange("custom", tt.from, tt.to, time.Now(), newYork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := reportQuery{Location: newYork, Start: start, End: end}
+			points, err := buildTimeSeries(nil, q, tt.interval)
+			if err != nil {
+				t.Fatalf("buildTimeSeries: %v", err)
+			}
+			if len(points) != tt.wantPoints {
+				t.Fatalf("got %d points, want %d", len(points), tt.wantPoints)
+			}
+			if first, last := points[0].Date, points[len(points)-1].Date; first != tt.wantFirst || last != tt.wantLast {
+				t.Errorf("points run from %s to %s, want %s to %s", first, last, tt.wantFirst, tt.wantLast)
+			}
+			seen := make(map[string]bool)
+			for _, p := range points {
+				if seen[p.Date] {
+					t.Errorf("bucket %s appears twice", p.Date)
+				}
+				seen[p.Date] = true
+			}
+		})
+	}
+}
+
+func TestBuildTimeSeriesCounts(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	start, end, _ := periodRange("custom", "2026-11-01", "2026-11-01", time.Now(), newYork)
+	q := reportQuery{Location: newYork, Start: start, End: end}
+
+	// 05:30 UTC is 01:30 EDT and 06:30 UTC is 01:30 EST: the same wall-clock time in different hours
+	first := time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)
+	second := time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC)
+	views := []PageView{
+		{Timestamp: first, SessionID: "s1", VisitorID: "v1"},
+		{Timestamp: first.Add(10 * time.Minute), SessionID: "s1", VisitorID: "v1"},
+		{Timestamp: first.Add(20 * time.Minute), SessionID: "s2", VisitorID: "v1"},
+		{Timestamp: second, SessionID: "s3", VisitorID: "v2"},
+	}
+
+	points, err := buildTimeSeries(views, q, "hour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]TimeSeriesPoint{
+		"2026-11-01T01:00:00-04:00": {Views: 3, Sessions: 2, Visitors: 1},
+		"2026-11-01T01:00:00-05:00": {Views: 1, Sessions: 1, Visitors: 1},
+	}
+	for _, p := range points {
+		w := want[p.Date]
+		if p.Views != w.Views || p.Sessions != w.Sessions || p.Visitors != w.Visitors {
+			t.Errorf("%s: got %d/%d/%d views/sessions/visitors, want %d/%d/%d",
+				p.Date, p.Views, p.Sessions, p.Visitors, w.Views, w.Sessions, w.Visitors)
+		}
+	}
+
+	// Days keep both hours together
+	points, _ = buildTimeSeries(views, q, "day")
+	if len(points) != 1 || points[0].Views != 4 || points[0].Sessions != 3 || points[0].Visitors != 2 {
+		t.Errorf("day buckets = %+v, want one point with 4 views, 3 sessions and 2 visitors", points)
+	}
+}
+
+func TestBuildTimeSeriesLimit(t *testing.T) {
+	start, end, _ := periodRange("custom", "2020-01-01", "2026-12-31", time.Now(), time.UTC)
+	q := reportQuery{Location: time.UTC, Start: start, End: end}
+	_, err := buildTimeSeries(nil, q, "hour")
+	var qe *queryError
+	if !errors.As(err, &qe) {
+		t.Errorf("hourly buckets over seven years: got %v, want a queryError", err)
+	}
+	if _, err := buildTimeSeries(nil, q, "day"); err != nil {
+		t.Errorf("daily buckets over seven years: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"regexp"  // For extracting version numbers and matching bot tokens
+	"strings" // For string manipulation
+)
+
+// =============================================================================
+// USER-AGENT PARSING
+// =============================================================================
+
+// Device classes reported in PageView.Device
+const (
+	deviceDesktop = "desktop"
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+	deviceBot     = "bot"
+)
+
+// UserAgentInfo holds the details parsed from a user-agent string
+type UserAgentInfo struct {
+	Browser        string // Browser name (e.g., "Chrome", "Samsung Internet")
+	BrowserVersion string // Major (or major.minor) browser version (e.g., "120", "17.2")
+	OS             string // Operating system name (e.g., "Windows", "iOS")
+	OSVersion      string // Operating system version (e.g., "10", "17.2")
+	Device         string // Device class: desktop, mobile, tablet or bot
+}
+
+// browserRule matches a user-agent token to a browser name
+// Rules are checked in order, so browsers built on Chrome or Safari must come before them
+type browserRule struct {
+	Token   string // Case-sensitive token to look for (e.g., "OPR/")
+	Name    string // Browser name to report
+	Version string // Token whose following number is the version; defaults to Token
+}
+
+var browserRules = []browserRule{
+	{Token: "EdgA/", Name: "Edge"},
+	{Token: "EdgiOS/", Name: "Edge"},
+	{Token: "Edg/", Name: "Edge"},
+	{Token: "Edge/", Name: "Edge"},
+	{Token: "OPR/", Name: "Opera"},
+	{Token: "OPT/", Name: "Opera"},
+	{Token: "OPiOS/", Name: "Opera"},
+	{Token: "Opera Mini/", Name: "Opera Mini"},
+	{Token: "Opera/", Name: "Opera", Version: "Version/"},
+	{Token: "SamsungBrowser/", Name: "Samsung Internet"},
+	{Token: "YaBrowser/", Name: "Yandex Browser"},
+	{Token: "UCBrowser/", Name: "UC Browser"},
+	{Token: "Vivaldi/", Name: "Vivaldi"},
+	{Token: "Brave/", Name: "Brave"},
+	{Token: "DuckDuckGo/", Name: "DuckDuckGo"},
+	{Token: "FBAV/", Name: "Facebook App"},
+	{Token: "FBAN/", Name: "Facebook App", Version: "FBAV/"},
+	{Token: "Instagram ", Name: "Instagram App"},
+	{Token: "Line/", Name: "LINE App"},
+	{Token: "CriOS/", Name: "Chrome"},
+	{Token: "FxiOS/", Name: "Firefox"},
+	{Token: "Firefox/", Name: "Firefox"},
+	{Token: "Chromium/", Name: "Chromium"},
+	{Token: "; wv)", Name: "Android WebView", Version: "Chrome/"},
+	{Token: "Chrome/", Name: "Chrome"},
+	{Token: "Trident/", Name: "Internet Explorer", Version: "rv:"},
+	{Token: "MSIE ", Name: "Internet Explorer"},
+}
+
+// botTokens identify crawlers, monitors and scripted clients (matched case-insensitively)
+// "bot" on its own is matched by botPattern instead, since it also appears inside words such as CUBOT phone models
+var botTokens = []string{
+	"crawler", "spider", "slurp", "headless", "lighthouse", "pingdom",
+	"curl/", "wget/", "python-requests", "go-http-client", "httpclient", "facebookexternalhit",
+}
+
+// botPattern matches "bot" as a word or as a product token: "Googlebot/2.1", "bingbot;", "AdsBot-Google",
+// "+https://help.qwant.com/bot)". It is applied to the lowercased user agent with botLookalikes removed.
+var botPattern = regexp.MustCompile(`\bbot\b|bot[/;)-]|-bot`)
+
+// botLookalikes are lowercase device and product names that end in "bot" but are not crawlers
+var botLookalikes = strings.NewReplacer("cubot", "")
+
+// versionPattern matches a dotted version number at the start of a string
+var versionPattern = regexp.MustCompile(`^[0-9]+(?:[._][0-9]+)*`)
+
+// windowsVersions maps Windows NT kernel versions to marketing names
+// Windows 11 still reports NT 10.0, so it cannot be told apart from Windows 10
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// parseUserAgent extracts browser, operating system and device details from a user-agent string
+func parseUserAgent(userAgent string) UserAgentInfo {
+	info := UserAgentInfo{Browser: "Other", OS: "Other", Device: deviceDesktop}
+	if userAgent == "" {
+		return info
+	}
+
+	if isBot(userAgent) {
+		info.Browser = "Bot"
+		info.Device = deviceBot
+		return info
+	}
+
+	info.Browser, info.BrowserVersion = parseBrowser(userAgent)
+	info.OS, info.OSVersion = parseOS(userAgent)
+	info.Device = parseDevice(userAgent, info.OS)
+	return info
+}
+
+// isBot reports whether a user agent belongs to a crawler, monitor or scripted client
+func isBot(userAgent string) bool {
+	lower := strings.ToLower(userAgent)
+	for _, token := range botTokens {
+		if strings.Contains(lower, token) {
+			return true
+		}
+	}
+	return botPattern.MatchString(botLookalikes.Replace(lower))
+}
+
+// parseBrowser identifies the browser name and version using browserRules
+func parseBrowser(userAgent string) (string, string) {
+	for _, rule := range browserRules {
+		if !strings.Contains(userAgent, rule.Token) {
+			continue
+		}
+		versionToken := rule.Version
+		if versionToken == "" {
+			versionToken = rule.Token
+		}
+		return rule.Name, shortVersion(versionAfter(userAgent, versionToken))
+	}
+
+	// Safari is the fallback for WebKit browsers that identify with "Version/x Safari/y"
+	if strings.Contains(userAgent, "Safari/") && strings.Contains(userAgent, "Version/") {
+		return "Safari", shortVersion(versionAfter(userAgent, "Version/"))
+	}
+	// iOS apps embedding WKWebView send a Safari-like UA without the Safari token
+	if strings.Contains(userAgent, "AppleWebKit/") && strings.Contains(userAgent, "Mobile/") {
+		return "iOS WebView", ""
+	}
+	return "Other", ""
+}
+
+// parseOS identifies the operating system name and version
+func parseOS(userAgent string) (string, string) {
+	switch {
+	case strings.Contains(userAgent, "Windows Phone"):
+		return "Windows Phone", versionAfter(userAgent, "Windows Phone ")
+	case strings.Contains(userAgent, "Windows NT "):
+		return "Windows", windowsVersions[versionAfter(userAgent, "Windows NT ")]
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		// iOS versions use underscores: "CPU iPhone OS 17_2 like Mac OS X"
+		return "iOS", versionAfter(userAgent, " OS ")
+	case strings.Contains(userAgent, "Android"):
+		return "Android", versionAfter(userAgent, "Android ")
+	case strings.Contains(userAgent, "CrOS"):
+		return "Chrome OS", ""
+	case strings.Contains(userAgent, "Mac OS X"):
+		return "macOS", versionAfter(userAgent, "Mac OS X ")
+	case strings.Contains(userAgent, "Linux"), strings.Contains(userAgent, "X11"):
+		return "Linux", ""
+	default:
+		return "Other", ""
+	}
+}
+
+// parseDevice classifies the device as desktop, mobile or tablet
+func parseDevice(userAgent, os string) string {
+	switch {
+	case strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "Kindle"), strings.Contains(userAgent, "Silk/"):
+		return deviceTablet
+	case strings.Contains(userAgent, "Tablet") && !strings.Contains(userAgent, "Tablet PC"):
+		// Windows desktops and laptops with pen or touch input send "Tablet PC 2.0"
+		return deviceTablet
+	case os == "Android" && !strings.Contains(userAgent, "Mobile"):
+		// Android tablets omit the "Mobile" token that phones send
+		return deviceTablet
+	case strings.Contains(userAgent, "Mobi"), strings.Contains(userAgent, "iPhone"),
+		strings.Contains(userAgent, "iPod"), os == "Windows Phone", os == "Android":
+		return deviceMobile
+	default:
+		return deviceDesktop
+	}
+}
+
+// versionAfter returns the version number that immediately follows token, with "_" normalized to "."
+func versionAfter(userAgent, token string) string {
+	idx := strings.Index(userAgent, token)
+	if idx < 0 {
+		return ""
+	}
+	version := versionPattern.FindString(userAgent[idx+len(token):])
+	return strings.ReplaceAll(version, "_", ".")
+}
+
+// shortVersion trims a browser version to major.minor, dropping a ".0" minor version
+// e.g., "120.0.6099.109" becomes "120" and "17.2.1" becomes "17.2"
+func shortVersion(version string) string {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 || parts[1] == "0" {
+		return parts[0]
+	}
+	return parts[0] + "." + parts[1]
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing" // For the test runner
+)
+
+// =============================================================================
+// USER-AGENT PARSING TESTS
+// =============================================================================
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      UserAgentInfo
+	}{
+		{
+			name:      "empty",
+			userAgent: "",
+			want:      UserAgentInfo{Browser: "Other", OS: "Other", Device: deviceDesktop},
+		},
+		{
+			name:      "Chrome on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.109 Safari/537.36",
+			want:      UserAgentInfo{Browser: "Chrome", BrowserVersion: "120", OS: "Windows", OSVersion: "10", Device: deviceDesktop},
+		},
+		{
+			name:      "Edge on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want:      UserAgentInfo{Browser: "Edge", BrowserVersion: "120", OS: "Windows", OSVersion: "10", Device: deviceDesktop},
+		},
+		{
+			name:      "Opera on Windows 7",
+			userAgent: "Mozilla/5.0 (Windows NT 6.1; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 OPR/105.0.0.0",
+			want:      UserAgentInfo{Browser: "Opera", BrowserVersion: "105", OS: "Windows", OSVersion: "7", Device: deviceDesktop},
+		},
+		{
+			name:      "Firefox on Linux",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want:      UserAgentInfo{Browser: "Firefox", BrowserVersion: "121", OS: "Linux", Device: deviceDesktop},
+		},
+		{
+			name:      "Safari on macOS",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2.1 Safari/605.1.15",
+			want:      UserAgentInfo{Browser: "Safari", BrowserVersion: "17.2", OS: "macOS", OSVersion: "10.15.7", Device: deviceDesktop},
+		},
+		{
+			name:      "Safari on iPhone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want:      UserAgentInfo{Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", OSVersion: "17.2", Device: deviceMobile},
+		},
+		{
+			name:      "Chrome on iPad",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			want:      UserAgentInfo{Browser: "Chrome", BrowserVersion: "120", OS: "iOS", OSVersion: "17.1", Device: deviceTablet},
+		},
+		{
+			name:      "iOS app webview",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148",
+			want:      UserAgentInfo{Browser: "iOS WebView", OS: "iOS", OSVersion: "16.6", Device: deviceMobile},
+		},
+		{
+			name:      "Samsung Internet on Android phone",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			want:      UserAgentInfo{Browser: "Samsung Internet", BrowserVersion: "23", OS: "Android", OSVersion: "13", Device: deviceMobile},
+		},
+		{
+			name:      "Android WebView",
+			userAgent: "Mozilla/5.0 (Linux; Android 12; Pixel 6; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/119.0.6045.163 Mobile Safari/537.36",
+			want:      UserAgentInfo{Browser: "Android WebView", BrowserVersion: "119", OS: "Android", OSVersion: "12", Device: deviceMobile},
+		},
+		{
+			name:      "Android tablet without Mobile token",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want:      UserAgentInfo{Browser: "Chrome", BrowserVersion: "120", OS: "Android", OSVersion: "13", Device: deviceTablet},
+		},
+		{
+			name:      "Internet Explorer 11",
+			userAgent: "Mozilla/5.0 (Windows NT 6.3; Trident/7.0; rv:11.0) like Gecko",
+			want:      UserAgentInfo{Browser: "Internet Explorer", BrowserVersion: "11", OS: "Windows", OSVersion: "8.1", Device: deviceDesktop},
+		},
+		{
+			name:      "Windows Tablet PC is a desktop",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; Touch; .NET4.0C; .NET4.0E; Tablet PC 2.0; rv:11.0) like Gecko",
+			want:      UserAgentInfo{Browser: "Internet Explorer", BrowserVersion: "11", OS: "Windows", OSVersion: "10", Device: deviceDesktop},
+		},
+		{
+			name:      "Firefox OS tablet",
+			userAgent: "Mozilla/5.0 (Tablet; rv:26.0) Gecko/26.0 Firefox/26.0",
+			want:      UserAgentInfo{Browser: "Firefox", BrowserVersion: "26", OS: "Other", Device: deviceTablet},
+		},
+		{
+			name:      "CUBOT phone is not a bot",
+			userAgent: "Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want:      UserAgentInfo{Browser: "Chrome", BrowserVersion: "120", OS: "Android", OSVersion: "10", Device: deviceMobile},
+		},
+		{
+			name:      "CUBOT model with underscore is not a bot",
+			userAgent: "Mozilla/5.0 (Linux; Android 9; CUBOT_P30 Build/PPR1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36",
+			want:      UserAgentInfo{Browser: "Chrome", BrowserVersion: "118", OS: "Android", OSVersion: "9", Device: deviceMobile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("parseUserAgent(%q)\n got  %+v\n want %+v", tt.userAgent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUserAgentBots(t *testing.T) {
+	bots := []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		"AdsBot-Google (+http://www.google.com/adsbot.html)",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+		"DuckDuckBot/1.1; (+http://duckduckgo.com/duckduckbot.html)",
+		"Mozilla/5.0 (compatible; Qwantify/Bleriot/1.1; +https://help.qwant.com/bot)",
+		"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)",
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bot; +https://example.com)",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		"curl/8.4.0",
+		"python-requests/2.31.0",
+		"Go-http-client/1.1",
+	}
+	for _, ua := range bots {
+		info := parseUserAgent(ua)
+		if info.Browser != "Bot" || info.Device != deviceBot {
+			t.Errorf("parseUserAgent(%q) = %s/%s, want Bot/%s", ua, info.Browser, info.Device, deviceBot)
+		}
+	}
+}